@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+
+	"github.com/akkahshh24/movieapp/gen"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// Input formats of rating events.
+const (
+	formatJSON      = "json"
+	formatJSONLines = "jsonl"
+	formatCSV       = "csv"
+	formatProto     = "proto"
+)
+
+// readRatingEvents reads rating events in the given format one at a time, so that large inputs
+// are not loaded into memory.
+func readRatingEvents(r io.Reader, format string) (iter.Seq2[model.RatingEvent, error], error) {
+	switch format {
+	case formatJSON:
+		return readJSON(r), nil
+	case formatJSONLines:
+		return readJSONLines(r), nil
+	case formatCSV:
+		return readCSV(r), nil
+	case formatProto:
+		return readProto(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported input format %q", format)
+	}
+}
+
+// readJSON reads a JSON array of rating events.
+func readJSON(r io.Reader) iter.Seq2[model.RatingEvent, error] {
+	return func(yield func(model.RatingEvent, error) bool) {
+		dec := json.NewDecoder(r)
+		t, err := dec.Token()
+		if err != nil {
+			yield(model.RatingEvent{}, fmt.Errorf("expected a JSON array: %w", err))
+			return
+		}
+		if t != json.Delim('[') {
+			yield(model.RatingEvent{}, fmt.Errorf("expected a JSON array, got %v", t))
+			return
+		}
+		for dec.More() {
+			var e model.RatingEvent
+			if err := dec.Decode(&e); err != nil {
+				yield(model.RatingEvent{}, err)
+				return
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+// readJSONLines reads JSON-encoded rating events, one per line.
+func readJSONLines(r io.Reader) iter.Seq2[model.RatingEvent, error] {
+	return func(yield func(model.RatingEvent, error) bool) {
+		scanner := bufio.NewScanner(r)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var e model.RatingEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				yield(model.RatingEvent{}, fmt.Errorf("line %d: %w", line, err))
+				return
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(model.RatingEvent{}, err)
+		}
+	}
+}
+
+// readCSV reads rating events from CSV with a header row naming the JSON fields of a rating event,
+// for example: userId,recordId,recordType,value,providerId,eventType
+func readCSV(r io.Reader) iter.Seq2[model.RatingEvent, error] {
+	return func(yield func(model.RatingEvent, error) bool) {
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			yield(model.RatingEvent{}, fmt.Errorf("read header: %w", err))
+			return
+		}
+
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(model.RatingEvent{}, err)
+				return
+			}
+
+			var e model.RatingEvent
+			for i, field := range header {
+				if err := setCSVField(&e, field, record[i]); err != nil {
+					line, _ := reader.FieldPos(i)
+					yield(model.RatingEvent{}, fmt.Errorf("line %d: %w", line, err))
+					return
+				}
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+// setCSVField sets the field of a rating event with the given JSON name.
+func setCSVField(e *model.RatingEvent, field string, value string) error {
+	switch field {
+	case "eventId":
+		e.EventID = value
+	case "userId":
+		e.UserID = model.UserID(value)
+	case "recordId":
+		e.RecordID = model.RecordID(value)
+	case "recordType":
+		e.RecordType = model.RecordType(value)
+	case "value":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", value)
+		}
+		e.Value = model.RatingValue(v)
+	case "providerId":
+		e.ProviderID = value
+	case "eventType":
+		e.EventType = model.RatingEventType(value)
+	default:
+		return fmt.Errorf("unknown column %q", field)
+	}
+	return nil
+}
+
+// readProto reads size-delimited RatingEvent protos.
+func readProto(r io.Reader) iter.Seq2[model.RatingEvent, error] {
+	return func(yield func(model.RatingEvent, error) bool) {
+		br := bufio.NewReader(r)
+		for {
+			var e gen.RatingEvent
+			if err := protodelim.UnmarshalFrom(br, &e); err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield(model.RatingEvent{}, err)
+				}
+				return
+			}
+			if !yield(*model.ProtoToRatingEvent(&e), nil) {
+				return
+			}
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"iter"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
@@ -11,64 +15,188 @@ import (
 )
 
 func main() {
-	fmt.Println("Creating a Kafka producer")
+	brokers := flag.String("brokers", "localhost", "comma-separated list of Kafka brokers")
+	topic := flag.String("topic", "ratings", "topic to produce the rating events to")
+	input := flag.String("input", "ratingsdata.json", "file to read the rating events from, or - for stdin")
+	format := flag.String("format", formatJSON, "format of the input: json (array), jsonl, csv or proto (size-delimited)")
+	encoding := flag.String("encoding", "json", "encoding of the produced events: json or proto")
+	rate := flag.Float64("rate", 0, "maximum number of events produced per second, or 0 for no limit")
+	timeout := flag.Duration("timeout", 10*time.Second, "time to wait for the delivery of the produced events")
 
-	// Create a new Kafka producer.
-	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": "localhost"})
-	if err != nil {
-		panic(err)
+	var synthetic syntheticConfig
+	flag.IntVar(&synthetic.count, "synthetic", 0, "number of random rating events to produce instead of reading the input")
+	flag.IntVar(&synthetic.users, "users", 1000, "number of distinct users of the synthetic load")
+	flag.IntVar(&synthetic.movies, "movies", 100, "number of distinct movies of the synthetic load")
+	flag.StringVar(&synthetic.distribution, "distribution", "uniform", "distribution of the movies of the synthetic load: uniform or zipf")
+	flag.Float64Var(&synthetic.zipfS, "zipf-s", 1.1, "skew of the zipf distribution, greater than 1")
+	flag.Int64Var(&synthetic.seed, "seed", time.Now().UnixNano(), "seed of the synthetic load")
+	flag.Parse()
+
+	if err := run(*brokers, *topic, *input, *format, *encoding, *rate, *timeout, synthetic); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	defer producer.Close()
+}
 
-	const fileName = "ratingsdata.json"
-	fmt.Println("Reading rating events from file " + fileName)
+// maxRate is the highest rate of events that can be paced, one per nanosecond.
+const maxRate = 1e9
 
-	// Read rating events from the JSON file.
-	ratingEvents, err := readRatingEvents(fileName)
-	if err != nil {
-		panic(err)
+func run(brokers string, topic string, input string, format string, encoding string, rate float64, timeout time.Duration, synthetic syntheticConfig) error {
+	// Written so that NaN is rejected too.
+	if !(rate >= 0 && rate <= maxRate) {
+		return fmt.Errorf("rate must be between 0 and %.0f events per second", float64(maxRate))
+	}
+	contentTypes := map[string]string{"json": model.ContentTypeJSON, "proto": model.ContentTypeProto}
+	contentType, ok := contentTypes[encoding]
+	if !ok {
+		return fmt.Errorf("unsupported encoding %q", encoding)
 	}
 
-	// Produce rating events to the Kafka topic.
-	const topic = "ratings"
-	if err := produceRatingEvents(topic, producer, ratingEvents); err != nil {
-		panic(err)
+	var events iter.Seq2[model.RatingEvent, error]
+	if synthetic.count > 0 {
+		fmt.Printf("Generating %d rating events\n", synthetic.count)
+		var err error
+		if events, err = generateRatingEvents(synthetic); err != nil {
+			return err
+		}
+	} else {
+		var r io.Reader = os.Stdin
+		if input != "-" {
+			f, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		fmt.Println("Reading rating events from " + input)
+		var err error
+		if events, err = readRatingEvents(r, format); err != nil {
+			return err
+		}
 	}
 
-	const timeout = 10 * time.Second
-	fmt.Println("Waiting " + timeout.String() + " until all events get produced")
+	fmt.Println("Creating a Kafka producer")
 
-	producer.Flush(int(timeout.Milliseconds()))
-}
+	// Create a new Kafka producer.
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": brokers})
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
 
-// readRatingEvents reads rating events from a JSON file.
-func readRatingEvents(fileName string) ([]model.RatingEvent, error) {
-	f, err := os.Open(fileName)
+	// Produce rating events to the Kafka topic.
+	deliveries := newDeliveryTracker()
+	go deliveries.track(producer.Events())
+	produced, err := produceRatingEvents(topic, producer, events, contentType, rate)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
-	var ratings []model.RatingEvent
-	if err := json.NewDecoder(f).Decode(&ratings); err != nil {
-		return nil, err
+
+	fmt.Println("Waiting up to " + timeout.String() + " until all events get delivered")
+	producer.Flush(int(timeout.Milliseconds()))
+	delivered, failed := deliveries.wait(produced, time.Second)
+
+	fmt.Printf("Produced %d events: %d delivered, %d failed, %d unconfirmed\n", produced, delivered, failed, produced-delivered-failed)
+	if delivered < produced {
+		return errors.New("not all events were delivered")
 	}
-	return ratings, nil
+	return nil
 }
 
-func produceRatingEvents(topic string, producer *kafka.Producer, events []model.RatingEvent) error {
-	for _, event := range events {
-		encodedEvent, err := json.Marshal(event)
+// produceRatingEvents encodes rating events with the given content type and produces them to a Kafka topic
+// at up to rate events per second. It returns the number of produced events.
+// The encoding is described by message headers, so that consumers can decode every message.
+func produceRatingEvents(topic string, producer *kafka.Producer, events iter.Seq2[model.RatingEvent, error], contentType string, rate float64) (int, error) {
+	var limit <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	var n int
+	for event, err := range events {
 		if err != nil {
-			return err
+			return n, err
+		}
+		encodedEvent, err := model.MarshalRatingEvent(&event, contentType)
+		if err != nil {
+			return n, err
+		}
+		if limit != nil {
+			<-limit
 		}
 
-		// Produce the event to the Kafka topic.
-		if err := producer.Produce(&kafka.Message{
+		msg := &kafka.Message{
 			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
-			Value:          []byte(encodedEvent),
-		}, nil); err != nil {
-			return err
+			// Keep the events of a record in order.
+			Key:   []byte(string(event.RecordType) + "/" + string(event.RecordID)),
+			Value: encodedEvent,
+			Headers: []kafka.Header{
+				{Key: model.HeaderContentType, Value: []byte(contentType)},
+				{Key: model.HeaderSchemaVersion, Value: []byte(model.RatingEventSchemaVersion)},
+			},
 		}
+
+		// Produce the event to the Kafka topic, waiting for room in the local queue if needed.
+		for {
+			err := producer.Produce(msg, nil)
+			var kafkaErr kafka.Error
+			if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrQueueFull {
+				producer.Flush(100)
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+			break
+		}
+		n++
+	}
+	return n, nil
+}
+
+// deliveryTracker counts the delivery reports of produced messages.
+type deliveryTracker struct {
+	mu        sync.Mutex
+	delivered int
+	failed    int
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{}
+}
+
+// track counts the delivery reports among the producer events until the channel is closed.
+func (t *deliveryTracker) track(events chan kafka.Event) {
+	for e := range events {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			t.mu.Lock()
+			if ev.TopicPartition.Error != nil {
+				t.failed++
+				fmt.Fprintf(os.Stderr, "Delivery failed: %v\n", ev.TopicPartition.Error)
+			} else {
+				t.delivered++
+			}
+			t.mu.Unlock()
+		case kafka.Error:
+			fmt.Fprintf(os.Stderr, "Kafka error: %v\n", ev)
+		}
+	}
+}
+
+// wait waits up to the timeout until all produced messages are reported and returns the counts.
+func (t *deliveryTracker) wait(produced int, timeout time.Duration) (delivered int, failed int) {
+	deadline := time.Now().Add(timeout)
+	for {
+		t.mu.Lock()
+		delivered, failed = t.delivered, t.failed
+		t.mu.Unlock()
+		if delivered+failed >= produced || time.Now().After(deadline) {
+			return delivered, failed
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	return nil
 }
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"iter"
+	"strings"
+	"testing"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// collect returns the events of a sequence up to the first error.
+func collect(events iter.Seq2[model.RatingEvent, error]) ([]model.RatingEvent, error) {
+	var res []model.RatingEvent
+	for e, err := range events {
+		if err != nil {
+			return res, err
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func TestReadRatingEvents(t *testing.T) {
+	alice := model.RatingEvent{
+		Rating:    model.Rating{UserID: "alice", RecordID: "1", RecordType: model.RecordTypeMovie, Value: 5, ProviderID: "partner"},
+		EventID:   "1",
+		EventType: model.RatingEventTypePut,
+	}
+	bob := model.RatingEvent{
+		Rating:    model.Rating{UserID: "bob", RecordID: "2", RecordType: model.RecordTypeMovie, Value: 3},
+		EventID:   "2",
+		EventType: model.RatingEventTypePut,
+	}
+	var delimited bytes.Buffer
+	for _, e := range []model.RatingEvent{alice, bob} {
+		if _, err := protodelim.MarshalTo(&delimited, e.ToProto()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []model.RatingEvent
+		wantErr string
+	}{
+		{
+			name:   "json",
+			format: formatJSON,
+			input: `[{"eventId": "1", "userId": "alice", "recordId": "1", "recordType": "movie", "value": 5, "providerId": "partner", "eventType": "put"},
+				{"eventId": "2", "userId": "bob", "recordId": "2", "recordType": "movie", "value": 3, "eventType": "put"}]`,
+			want: []model.RatingEvent{alice, bob},
+		},
+		{
+			name:    "json object",
+			format:  formatJSON,
+			input:   `{"eventId": "1"}`,
+			wantErr: "expected a JSON array, got {",
+		},
+		{
+			name:    "empty json",
+			format:  formatJSON,
+			wantErr: "expected a JSON array: EOF",
+		},
+		{
+			name:   "json lines",
+			format: formatJSONLines,
+			input: `{"eventId": "1", "userId": "alice", "recordId": "1", "recordType": "movie", "value": 5, "providerId": "partner", "eventType": "put"}
+
+{"eventId": "2", "userId": "bob", "recordId": "2", "recordType": "movie", "value": 3, "eventType": "put"}`,
+			want: []model.RatingEvent{alice, bob},
+		},
+		{
+			name:    "invalid json line",
+			format:  formatJSONLines,
+			input:   "{\"eventId\": \"1\"}\nnot json",
+			want:    []model.RatingEvent{{EventID: "1"}},
+			wantErr: "line 2:",
+		},
+		{
+			name:   "csv",
+			format: formatCSV,
+			input:  "eventId,userId,recordId,recordType,value,providerId,eventType\n1,alice,1,movie,5,partner,put\n2,bob,2,movie,3,,put\n",
+			want:   []model.RatingEvent{alice, bob},
+		},
+		{
+			name:    "csv with an invalid value",
+			format:  formatCSV,
+			input:   "userId,value\nalice,five\n",
+			wantErr: `line 2: invalid value "five"`,
+		},
+		{
+			name:    "empty csv",
+			format:  formatCSV,
+			wantErr: "read header: EOF",
+		},
+		{
+			name:   "proto",
+			format: formatProto,
+			input:  delimited.String(),
+			want:   []model.RatingEvent{alice, bob},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := readRatingEvents(strings.NewReader(tt.input), tt.format)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got, err := collect(events)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := readRatingEvents(strings.NewReader(""), "xml")
+	assert.EqualError(t, err, `unsupported input format "xml"`)
+}
+
+func TestSetCSVField(t *testing.T) {
+	tests := []struct {
+		field   string
+		value   string
+		want    model.RatingEvent
+		wantErr string
+	}{
+		{field: "eventId", value: "1", want: model.RatingEvent{EventID: "1"}},
+		{field: "userId", value: "alice", want: model.RatingEvent{Rating: model.Rating{UserID: "alice"}}},
+		{field: "recordId", value: "1", want: model.RatingEvent{Rating: model.Rating{RecordID: "1"}}},
+		{field: "recordType", value: "movie", want: model.RatingEvent{Rating: model.Rating{RecordType: model.RecordTypeMovie}}},
+		{field: "value", value: "4", want: model.RatingEvent{Rating: model.Rating{Value: 4}}},
+		{field: "value", value: "4.5", wantErr: `invalid value "4.5"`},
+		{field: "providerId", value: "partner", want: model.RatingEvent{Rating: model.Rating{ProviderID: "partner"}}},
+		{field: "eventType", value: "delete", want: model.RatingEvent{EventType: model.RatingEventTypeDelete}},
+		{field: "weight", value: "1", wantErr: `unknown column "weight"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field+"="+tt.value, func(t *testing.T) {
+			var got model.RatingEvent
+			err := setCSVField(&got, tt.field, tt.value)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGenerateRatingEvents(t *testing.T) {
+	valid := syntheticConfig{count: 50, users: 10, movies: 5, distribution: "uniform", seed: 1}
+
+	tests := []struct {
+		name    string
+		modify  func(*syntheticConfig)
+		wantErr string
+	}{
+		{name: "uniform", modify: func(*syntheticConfig) {}},
+		{name: "zipf", modify: func(c *syntheticConfig) { c.distribution, c.zipfS = "zipf", 1.1 }},
+		{name: "single movie", modify: func(c *syntheticConfig) { c.movies = 1 }},
+		{name: "no users", modify: func(c *syntheticConfig) { c.users = 0 }, wantErr: "users and movies must be positive"},
+		{name: "no movies", modify: func(c *syntheticConfig) { c.movies = 0 }, wantErr: "users and movies must be positive"},
+		{name: "flat zipf", modify: func(c *syntheticConfig) { c.distribution, c.zipfS = "zipf", 1 }, wantErr: "zipf skew must be greater than 1"},
+		{name: "unknown distribution", modify: func(c *syntheticConfig) { c.distribution = "normal" }, wantErr: `unsupported distribution "normal"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			events, err := generateRatingEvents(cfg)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			got, err := collect(events)
+			assert.NoError(t, err)
+			assert.Len(t, got, cfg.count)
+			ids := map[string]bool{}
+			for _, e := range got {
+				ids[e.EventID] = true
+				assert.Equal(t, "synthetic", e.ProviderID)
+				assert.Equal(t, model.RatingEventTypePut, e.EventType)
+				assert.Contains(t, []model.RecordID{"1", "2", "3", "4", "5"}[:cfg.movies], e.RecordID)
+				assert.True(t, e.Value >= 1 && e.Value <= 5, "value %d out of range", e.Value)
+			}
+			// Event ids are unique, so the events are not skipped as redeliveries.
+			assert.Len(t, ids, cfg.count)
+
+			// The same seed generates the same events.
+			again, err := generateRatingEvents(cfg)
+			assert.NoError(t, err)
+			gotAgain, err := collect(again)
+			assert.NoError(t, err)
+			assert.Equal(t, got, gotAgain)
+		})
+	}
+}
+
+func TestRunRejectsInvalidRates(t *testing.T) {
+	for _, rate := range []float64{-1, 2e9} {
+		err := run("localhost", "ratings", "-", formatJSON, "json", rate, 0, syntheticConfig{})
+		assert.ErrorContains(t, err, "rate must be between 0 and 1000000000")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"math/rand"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// syntheticConfig defines a synthetic load of random ratings.
+type syntheticConfig struct {
+	count  int
+	users  int
+	movies int
+	// distribution is how often movies are rated: uniform, or zipf for a few popular movies and a long tail.
+	distribution string
+	// zipfS is the skew of the zipf distribution. It must be greater than 1.
+	zipfS float64
+	seed  int64
+}
+
+// generateRatingEvents generates random rating events of random users for random movies.
+func generateRatingEvents(cfg syntheticConfig) (iter.Seq2[model.RatingEvent, error], error) {
+	if cfg.users < 1 || cfg.movies < 1 {
+		return nil, fmt.Errorf("users and movies must be positive")
+	}
+
+	rnd := rand.New(rand.NewSource(cfg.seed))
+	var movie func() int
+	switch cfg.distribution {
+	case "uniform":
+		movie = func() int { return rnd.Intn(cfg.movies) }
+	case "zipf":
+		if cfg.zipfS <= 1 {
+			return nil, fmt.Errorf("zipf skew must be greater than 1")
+		}
+		zipf := rand.NewZipf(rnd, cfg.zipfS, 1, uint64(cfg.movies-1))
+		movie = func() int { return int(zipf.Uint64()) }
+	default:
+		return nil, fmt.Errorf("unsupported distribution %q", cfg.distribution)
+	}
+
+	return func(yield func(model.RatingEvent, error) bool) {
+		for i := 0; i < cfg.count; i++ {
+			e := model.RatingEvent{
+				Rating: model.Rating{
+					UserID:     model.UserID(fmt.Sprintf("user-%d", rnd.Intn(cfg.users))),
+					RecordID:   model.RecordID(fmt.Sprintf("%d", movie()+1)),
+					RecordType: model.RecordTypeMovie,
+					Value:      model.RatingValue(rnd.Intn(5) + 1),
+					ProviderID: "synthetic",
+				},
+				EventID:   fmt.Sprintf("synthetic-%d-%d", cfg.seed, i),
+				EventType: model.RatingEventTypePut,
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}, nil
+}
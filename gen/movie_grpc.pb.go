@@ -159,8 +159,12 @@ var MetadataService_ServiceDesc = grpc.ServiceDesc{
 }
 
 const (
-	RatingService_GetAggregatedRating_FullMethodName = "/RatingService/GetAggregatedRating"
-	RatingService_PutRating_FullMethodName           = "/RatingService/PutRating"
+	RatingService_GetAggregatedRating_FullMethodName  = "/RatingService/GetAggregatedRating"
+	RatingService_PutRating_FullMethodName            = "/RatingService/PutRating"
+	RatingService_DeleteRating_FullMethodName         = "/RatingService/DeleteRating"
+	RatingService_ListRatingHistory_FullMethodName    = "/RatingService/ListRatingHistory"
+	RatingService_ListUserRatings_FullMethodName      = "/RatingService/ListUserRatings"
+	RatingService_PurgeProviderRatings_FullMethodName = "/RatingService/PurgeProviderRatings"
 )
 
 // RatingServiceClient is the client API for RatingService service.
@@ -169,6 +173,10 @@ const (
 type RatingServiceClient interface {
 	GetAggregatedRating(ctx context.Context, in *GetAggregatedRatingRequest, opts ...grpc.CallOption) (*GetAggregatedRatingResponse, error)
 	PutRating(ctx context.Context, in *PutRatingRequest, opts ...grpc.CallOption) (*PutRatingResponse, error)
+	DeleteRating(ctx context.Context, in *DeleteRatingRequest, opts ...grpc.CallOption) (*DeleteRatingResponse, error)
+	ListRatingHistory(ctx context.Context, in *ListRatingHistoryRequest, opts ...grpc.CallOption) (*ListRatingHistoryResponse, error)
+	ListUserRatings(ctx context.Context, in *ListUserRatingsRequest, opts ...grpc.CallOption) (*ListUserRatingsResponse, error)
+	PurgeProviderRatings(ctx context.Context, in *PurgeProviderRatingsRequest, opts ...grpc.CallOption) (*PurgeProviderRatingsResponse, error)
 }
 
 type ratingServiceClient struct {
@@ -199,12 +207,56 @@ func (c *ratingServiceClient) PutRating(ctx context.Context, in *PutRatingReques
 	return out, nil
 }
 
+func (c *ratingServiceClient) DeleteRating(ctx context.Context, in *DeleteRatingRequest, opts ...grpc.CallOption) (*DeleteRatingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteRatingResponse)
+	err := c.cc.Invoke(ctx, RatingService_DeleteRating_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratingServiceClient) ListRatingHistory(ctx context.Context, in *ListRatingHistoryRequest, opts ...grpc.CallOption) (*ListRatingHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRatingHistoryResponse)
+	err := c.cc.Invoke(ctx, RatingService_ListRatingHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratingServiceClient) ListUserRatings(ctx context.Context, in *ListUserRatingsRequest, opts ...grpc.CallOption) (*ListUserRatingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListUserRatingsResponse)
+	err := c.cc.Invoke(ctx, RatingService_ListUserRatings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ratingServiceClient) PurgeProviderRatings(ctx context.Context, in *PurgeProviderRatingsRequest, opts ...grpc.CallOption) (*PurgeProviderRatingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PurgeProviderRatingsResponse)
+	err := c.cc.Invoke(ctx, RatingService_PurgeProviderRatings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // RatingServiceServer is the server API for RatingService service.
 // All implementations must embed UnimplementedRatingServiceServer
 // for forward compatibility.
 type RatingServiceServer interface {
 	GetAggregatedRating(context.Context, *GetAggregatedRatingRequest) (*GetAggregatedRatingResponse, error)
 	PutRating(context.Context, *PutRatingRequest) (*PutRatingResponse, error)
+	DeleteRating(context.Context, *DeleteRatingRequest) (*DeleteRatingResponse, error)
+	ListRatingHistory(context.Context, *ListRatingHistoryRequest) (*ListRatingHistoryResponse, error)
+	ListUserRatings(context.Context, *ListUserRatingsRequest) (*ListUserRatingsResponse, error)
+	PurgeProviderRatings(context.Context, *PurgeProviderRatingsRequest) (*PurgeProviderRatingsResponse, error)
 	mustEmbedUnimplementedRatingServiceServer()
 }
 
@@ -221,6 +273,18 @@ func (UnimplementedRatingServiceServer) GetAggregatedRating(context.Context, *Ge
 func (UnimplementedRatingServiceServer) PutRating(context.Context, *PutRatingRequest) (*PutRatingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PutRating not implemented")
 }
+func (UnimplementedRatingServiceServer) DeleteRating(context.Context, *DeleteRatingRequest) (*DeleteRatingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRating not implemented")
+}
+func (UnimplementedRatingServiceServer) ListRatingHistory(context.Context, *ListRatingHistoryRequest) (*ListRatingHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRatingHistory not implemented")
+}
+func (UnimplementedRatingServiceServer) ListUserRatings(context.Context, *ListUserRatingsRequest) (*ListUserRatingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUserRatings not implemented")
+}
+func (UnimplementedRatingServiceServer) PurgeProviderRatings(context.Context, *PurgeProviderRatingsRequest) (*PurgeProviderRatingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeProviderRatings not implemented")
+}
 func (UnimplementedRatingServiceServer) mustEmbedUnimplementedRatingServiceServer() {}
 func (UnimplementedRatingServiceServer) testEmbeddedByValue()                       {}
 
@@ -278,6 +342,78 @@ func _RatingService_PutRating_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RatingService_DeleteRating_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRatingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatingServiceServer).DeleteRating(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RatingService_DeleteRating_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatingServiceServer).DeleteRating(ctx, req.(*DeleteRatingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RatingService_ListRatingHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRatingHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatingServiceServer).ListRatingHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RatingService_ListRatingHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatingServiceServer).ListRatingHistory(ctx, req.(*ListRatingHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RatingService_ListUserRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUserRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatingServiceServer).ListUserRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RatingService_ListUserRatings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatingServiceServer).ListUserRatings(ctx, req.(*ListUserRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RatingService_PurgeProviderRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeProviderRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RatingServiceServer).PurgeProviderRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RatingService_PurgeProviderRatings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RatingServiceServer).PurgeProviderRatings(ctx, req.(*PurgeProviderRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // RatingService_ServiceDesc is the grpc.ServiceDesc for RatingService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -293,6 +429,22 @@ var RatingService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PutRating",
 			Handler:    _RatingService_PutRating_Handler,
 		},
+		{
+			MethodName: "DeleteRating",
+			Handler:    _RatingService_DeleteRating_Handler,
+		},
+		{
+			MethodName: "ListRatingHistory",
+			Handler:    _RatingService_ListRatingHistory_Handler,
+		},
+		{
+			MethodName: "ListUserRatings",
+			Handler:    _RatingService_ListUserRatings_Handler,
+		},
+		{
+			MethodName: "PurgeProviderRatings",
+			Handler:    _RatingService_PurgeProviderRatings_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "movie.proto",
@@ -2,23 +2,126 @@ package grpcutil
 
 import (
 	"context"
+	"errors"
 	"math/rand"
+	"net/url"
+	"strings"
 
 	"github.com/akkahshh24/movieapp/pkg/discovery"
-	"github.com/akkahshh24/movieapp/pkg/model"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-// ServiceConnection attempts to select a random service instance and returns a gRPC connection to it.
-func ServiceConnection(ctx context.Context, serviceName string, registry discovery.Registry) (*grpc.ClientConn, error) {
-	// Get the service endpoints from the registry.
-	// This will return a list of addresses for the service instances.
-	addrs, err := registry.ServiceEndpoints(ctx, model.ServiceName(serviceName))
+// roundRobinConfig is a service config spreading the calls over all endpoints of a service.
+const roundRobinConfig = `{"loadBalancingConfig": [{"round_robin": {}}]}`
+
+// ServiceConnection creates a long-lived gRPC connection to all instances of a service having all the given tags,
+// which follows the instances found in the registry and spreads the calls over them in a round-robin fashion.
+// The connection is meant to be shared and must be closed when no longer needed.
+func ServiceConnection(serviceName string, registry discovery.Registry, tags ...string) (*grpc.ClientConn, error) {
+	target := Scheme + ":///" + serviceName
+	if len(tags) > 0 {
+		target += "?" + url.Values{"tag": tags}.Encode()
+	}
+	return grpc.NewClient(target,
+		grpc.WithResolvers(NewResolverBuilder(registry)),
+		grpc.WithDefaultServiceConfig(roundRobinConfig),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+// Canary defines the canary instances of a service, which receive a percentage of the calls.
+type Canary struct {
+	// Tags are the tags of the canary instances, for example version=v2.
+	Tags []string
+	// Percent is the percentage of the calls sent to the canary instances.
+	Percent int
+}
+
+// CanaryConnection defines a gRPC connection to a service sending a percentage of the calls to its canary instances.
+// The calls go to the other instances unless the canary instances are connected and ready.
+type CanaryConnection struct {
+	stable  *grpc.ClientConn
+	canary  *grpc.ClientConn
+	percent int
+}
+
+// NewCanaryConnection creates a long-lived gRPC connection to the instances of a service having all the given tags,
+// sending canary.Percent of the calls to the instances having all the canary tags instead.
+// The canary instances are not used if canary.Percent is 0.
+// The canary tags must give another value to a key of the given tags, for example version=v2 against version=v1,
+// so that the canary instances do not receive the calls meant for the other instances too.
+func NewCanaryConnection(serviceName string, registry discovery.Registry, tags []string, canary Canary) (*CanaryConnection, error) {
+	if canary.Percent < 0 || canary.Percent > 100 {
+		return nil, errors.New("canary percentage must be between 0 and 100")
+	}
+	if (len(canary.Tags) > 0 || canary.Percent > 0) && !disjoint(tags, canary.Tags) {
+		return nil, errors.New("canary tags must give another value to a key of the service tags")
+	}
+	stable, err := ServiceConnection(serviceName, registry, tags...)
 	if err != nil {
 		return nil, err
 	}
+	c := &CanaryConnection{stable: stable, percent: canary.Percent}
+	if canary.Percent > 0 {
+		if c.canary, err = ServiceConnection(serviceName, registry, canary.Tags...); err != nil {
+			stable.Close()
+			return nil, err
+		}
+		// The canary connection is established upfront, so its state tells whether the canary instances are reachable.
+		c.canary.Connect()
+	}
+	return c, nil
+}
+
+// disjoint checks whether no instance can have both sets of tags, that is whether they give different
+// values to the same key.
+func disjoint(tags, other []string) bool {
+	for _, tag := range tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		for _, o := range other {
+			if key, value, found := strings.Cut(o, "="); found && key == k && value != v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Invoke performs a unary call over the stable or the canary connection.
+func (c *CanaryConnection) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	return c.pick().Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream begins a streaming call over the stable or the canary connection.
+func (c *CanaryConnection) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.pick().NewStream(ctx, desc, method, opts...)
+}
+
+// Close closes the connections to the service.
+func (c *CanaryConnection) Close() error {
+	if c.canary != nil {
+		c.canary.Close()
+	}
+	return c.stable.Close()
+}
 
-	// Create a gRPC client connection to a random service instance.
-	return grpc.NewClient(addrs[rand.Intn(len(addrs))], grpc.WithTransportCredentials(insecure.NewCredentials()))
+// pick returns the connection used by a call.
+func (c *CanaryConnection) pick() *grpc.ClientConn {
+	if c.canary == nil || rand.Intn(100) >= c.percent {
+		return c.stable
+	}
+	// A canary connection that is connecting, failing or has gone idle would fail or delay the call.
+	// An idle connection is asked to connect again, so that it is ready for the next calls.
+	if state := c.canary.GetState(); state != connectivity.Ready {
+		if state == connectivity.Idle {
+			c.canary.Connect()
+		}
+		return c.stable
+	}
+	return c.canary
 }
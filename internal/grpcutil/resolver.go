@@ -0,0 +1,83 @@
+package grpcutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery"
+	"github.com/akkahshh24/movieapp/pkg/model"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the scheme of the gRPC targets resolved through a service registry, for example: registry:///rating
+// The instances may be filtered by tags given as query parameters, for example: registry:///rating?tag=version%3Dv2
+const Scheme = "registry"
+
+// resolverBuilder defines a gRPC resolver builder resolving service names through a service registry.
+type resolverBuilder struct {
+	registry discovery.Registry
+}
+
+// NewResolverBuilder creates a gRPC resolver builder for the registry scheme that watches the endpoints of a service.
+func NewResolverBuilder(registry discovery.Registry) resolver.Builder {
+	return &resolverBuilder{registry: registry}
+}
+
+// Build creates a resolver pushing the endpoints of the target service to a client connection.
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	serviceName := model.ServiceName(target.Endpoint())
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := b.registry.Watch(ctx, serviceName, target.URL.Query()["tag"]...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	r := &registryResolver{serviceName: serviceName, cc: cc, cancel: cancel}
+	r.wg.Add(1)
+	go r.watch(updates)
+	return r, nil
+}
+
+// Scheme returns the scheme resolved by the builder.
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+// registryResolver defines a gRPC resolver of the endpoints of a service.
+type registryResolver struct {
+	serviceName model.ServiceName
+	cc          resolver.ClientConn
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// ResolveNow does nothing, as the registry pushes every change of the endpoints.
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close stops the resolver.
+func (r *registryResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// watch pushes the endpoints to the client connection whenever they change, until the resolver is closed.
+func (r *registryResolver) watch(updates <-chan discovery.Update) {
+	defer r.wg.Done()
+	for u := range updates {
+		if u.Err != nil {
+			// The registry cannot be reached, so gRPC keeps using the endpoints it already knows of, if any.
+			r.cc.ReportError(fmt.Errorf("service %s: %w", r.serviceName, u.Err))
+			continue
+		}
+		// An empty list of endpoints is pushed too, so that instances removed from the registry stop
+		// receiving calls even if they are still running. The calls then fail until an instance is back.
+		state := resolver.State{}
+		for _, addr := range u.Endpoints {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		r.cc.UpdateState(state)
+	}
+}
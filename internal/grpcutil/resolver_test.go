@@ -0,0 +1,164 @@
+package grpcutil
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery/memory"
+	"github.com/akkahshh24/movieapp/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func startHealthServer(t *testing.T) (*grpc.Server, string) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	return srv, lis.Addr().String()
+}
+
+func TestResolverBalancesOverRegisteredInstances(t *testing.T) {
+	ctx := context.Background()
+	registry := memory.NewRegistry()
+	srv1, addr1 := startHealthServer(t)
+	defer srv1.Stop()
+	srv2, addr2 := startHealthServer(t)
+	defer srv2.Stop()
+	require.NoError(t, registry.Register(ctx, "test-1", "test", addr1, nil))
+	require.NoError(t, registry.Register(ctx, "test-2", "test", addr2, nil))
+
+	conn, err := grpc.NewClient(Scheme+":///test",
+		grpc.WithResolvers(NewResolverBuilder(registry)),
+		grpc.WithDefaultServiceConfig(roundRobinConfig),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	// peers calls the service a few times and returns the addresses of the instances that answered.
+	peers := func() map[string]bool {
+		res := map[string]bool{}
+		for range 10 {
+			var p peer.Peer
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Peer(&p))
+			require.NoError(t, err)
+			res[p.Addr.String()] = true
+		}
+		return res
+	}
+	// Both instances are used once the connection is ready to reach them.
+	assert.Eventually(t, func() bool { return len(peers()) == 2 }, time.Second, 10*time.Millisecond)
+
+	// A deregistered instance is no longer used.
+	require.NoError(t, registry.Deregister(ctx, "test-1", "test"))
+	srv1.Stop()
+	assert.Eventually(t, func() bool {
+		p := peers()
+		return len(p) == 1 && p[addr2]
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestResolverStopsCallingDeregisteredInstances(t *testing.T) {
+	ctx := context.Background()
+	registry := memory.NewRegistry()
+	srv, addr := startHealthServer(t)
+	defer srv.Stop()
+	require.NoError(t, registry.Register(ctx, "test-1", "test", addr, nil))
+
+	conn, err := ServiceConnection("test", registry)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+
+	// The instance is still running, but it is no longer called once it is removed from the registry.
+	require.NoError(t, registry.Deregister(ctx, "test-1", "test"))
+	assert.Eventually(t, func() bool {
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return status.Code(err) == codes.Unavailable
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCanaryConnection(t *testing.T) {
+	ctx := context.Background()
+	registry := memory.NewRegistry()
+	srv1, addr1 := startHealthServer(t)
+	defer srv1.Stop()
+	srv2, addr2 := startHealthServer(t)
+	defer srv2.Stop()
+	require.NoError(t, registry.Register(ctx, "test-1", "test", addr1, model.InstanceMetadata{"version": "v1"}))
+	require.NoError(t, registry.Register(ctx, "test-2", "test", addr2, model.InstanceMetadata{"version": "v2"}))
+
+	// peers calls the service over a connection a few times and returns the addresses of the instances that answered.
+	peers := func(conn grpc.ClientConnInterface) map[string]bool {
+		res := map[string]bool{}
+		for range 20 {
+			var p peer.Peer
+			if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p)); err == nil {
+				res[p.Addr.String()] = true
+			}
+		}
+		return res
+	}
+
+	// All calls go to the canary instance.
+	conn, err := NewCanaryConnection("test", registry, []string{"version=v1"}, Canary{Tags: []string{"version=v2"}, Percent: 100})
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		p := peers(conn)
+		return len(p) == 1 && p[addr2]
+	}, time.Second, 10*time.Millisecond)
+
+	// The calls go to the stable instance while there is no canary instance.
+	conn, err = NewCanaryConnection("test", registry, []string{"version=v1"}, Canary{Tags: []string{"version=v3"}, Percent: 100})
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		p := peers(conn)
+		return len(p) == 1 && p[addr1]
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewCanaryConnectionRequiresDisjointTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		canary  Canary
+		wantErr bool
+	}{
+		{name: "no canary"},
+		{name: "disjoint", tags: []string{"version=v1"}, canary: Canary{Tags: []string{"version=v2"}, Percent: 10}},
+		{name: "disjoint without calls", tags: []string{"region=eu", "version=v1"}, canary: Canary{Tags: []string{"version=v2"}}},
+		// The canary instances would receive the calls meant for the other instances too.
+		{name: "no service tags", canary: Canary{Tags: []string{"version=v2"}, Percent: 10}, wantErr: true},
+		{name: "no service tags without calls", canary: Canary{Tags: []string{"version=v2"}}, wantErr: true},
+		{name: "other keys", tags: []string{"region=eu"}, canary: Canary{Tags: []string{"version=v2"}, Percent: 10}, wantErr: true},
+		{name: "same tags", tags: []string{"version=v1"}, canary: Canary{Tags: []string{"version=v1"}, Percent: 10}, wantErr: true},
+		{name: "no canary tags", tags: []string{"version=v1"}, canary: Canary{Percent: 10}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := NewCanaryConnection("test", memory.NewRegistry(), tt.tags, tt.canary)
+			if tt.wantErr {
+				assert.EqualError(t, err, "canary tags must give another value to a key of the service tags")
+				return
+			}
+			require.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
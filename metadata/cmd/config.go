@@ -1,18 +1,42 @@
 package main
 
+import (
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
+)
+
 type config struct {
 	API              apiConfig              `yaml:"api"`
 	ServiceDiscovery serviceDiscoveryConfig `yaml:"serviceDiscovery"`
 	Database         databaseConfig         `yaml:"database"`
+	Cache            cacheConfig            `yaml:"cache"`
 }
 
 type apiConfig struct {
 	Port int `yaml:"port"`
+	// MetricsPort is the port of the HTTP server exposing metrics on /debug/vars. It is disabled if 0.
+	MetricsPort int `yaml:"metricsPort"`
 }
 
 type serviceDiscoveryConfig struct {
-	Name   string       `yaml:"name"`
-	Consul consulConfig `yaml:"consul"`
+	// Type is the service registry: consul, static, with the instances listed in the config, or file,
+	// with the instances listed in a file that is reloaded when it changes.
+	Type string `yaml:"type"`
+	Name string `yaml:"name"`
+	// Metadata is registered along with the service instance, for example its version and zone.
+	// Each entry is also a tag of the instance, in the form key=value.
+	Metadata map[string]string `yaml:"metadata"`
+	Consul   consulConfig      `yaml:"consul"`
+	// Static maps each service to its instances, given as addresses or as mappings with an address and metadata.
+	Static map[string][]static.Endpoint `yaml:"static"`
+	File   registryFileConfig           `yaml:"file"`
+}
+
+// registryFileConfig defines a YAML or JSON file mapping each service to its instances, like the static config.
+type registryFileConfig struct {
+	Path         string        `yaml:"path"`
+	PollInterval time.Duration `yaml:"pollInterval"`
 }
 
 type consulConfig struct {
@@ -26,3 +50,25 @@ type databaseConfig struct {
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 }
+
+// cacheConfig defines the metadata cache.
+type cacheConfig struct {
+	// Type is the cache backend: memory, private to each replica, or redis, shared by all replicas.
+	Type string `yaml:"type"`
+	// MaxEntries is the number of movies cached at most in memory. It is unbounded if 0.
+	MaxEntries int `yaml:"maxEntries"`
+	// TTL is how long movie metadata is cached. It never expires if 0.
+	TTL time.Duration `yaml:"ttl"`
+	// NegativeTTL is how long movie ids that are not found are remembered as missing. They are not remembered if 0.
+	NegativeTTL time.Duration `yaml:"negativeTTL"`
+	Redis       redisConfig   `yaml:"redis"`
+}
+
+// redisConfig defines a Redis or compatible server.
+type redisConfig struct {
+	Address string `yaml:"address"`
+	// Namespace prefixes the keys of the service, so that services can share a server.
+	Namespace string        `yaml:"namespace"`
+	PoolSize  int           `yaml:"poolSize"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
@@ -2,20 +2,27 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/akkahshh24/movieapp/gen"
+	"github.com/akkahshh24/movieapp/metadata/internal/cache/memory"
+	"github.com/akkahshh24/movieapp/metadata/internal/cache/redis"
 	"github.com/akkahshh24/movieapp/metadata/internal/controller/metadata"
 	grpchandler "github.com/akkahshh24/movieapp/metadata/internal/handler/grpc"
-	"github.com/akkahshh24/movieapp/metadata/internal/repository/memory"
 	"github.com/akkahshh24/movieapp/metadata/internal/repository/mysql"
+	metadatamodel "github.com/akkahshh24/movieapp/metadata/pkg/model"
 	"github.com/akkahshh24/movieapp/pkg/discovery"
 	"github.com/akkahshh24/movieapp/pkg/discovery/consul"
+	"github.com/akkahshh24/movieapp/pkg/discovery/file"
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
 	"github.com/akkahshh24/movieapp/pkg/model"
+	"github.com/akkahshh24/movieapp/pkg/resp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"gopkg.in/yaml.v3"
@@ -35,18 +42,18 @@ func main() {
 	port := cfg.API.Port
 	log.Printf("Starting the metadata service on port %d", port)
 
-	// Create a new Consul registry
-	// This will be used for service discovery.
-	registry, err := consul.NewRegistry(cfg.ServiceDiscovery.Consul.Address)
+	// Create the service registry, Consul by default.
+	// It is used both to register this service and to discover the other services.
+	ctx := context.Background()
+	registry, err := newRegistry(ctx, cfg.ServiceDiscovery)
 	if err != nil {
 		panic(err)
 	}
 
 	// Register the metadata service
-	ctx := context.Background()
 	serviceName := model.ServiceName(cfg.ServiceDiscovery.Name)
 	instanceID := discovery.GenerateInstanceID(serviceName)
-	if err := registry.Register(ctx, instanceID, serviceName, fmt.Sprintf("%s:%d", serviceName, port)); err != nil {
+	if err := registry.Register(ctx, instanceID, serviceName, fmt.Sprintf("%s:%d", serviceName, port), cfg.ServiceDiscovery.Metadata); err != nil {
 		panic(err)
 	}
 
@@ -72,8 +79,22 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	cache := memory.New()
-	ctrl := metadata.New(repo, cache)
+	cache, cacheStats, err := newCache(cfg.Cache)
+	if err != nil {
+		log.Fatalf("failed to initialize cache: %v", err)
+	}
+	ctrl := metadata.New(repo, cache, cfg.Cache.NegativeTTL)
+
+	// Expose the cache metrics, for example: curl localhost:9081/debug/vars
+	expvar.Publish("cache", expvar.Func(cacheStats))
+	expvar.Publish("loader", expvar.Func(func() any { return ctrl.LoaderMetrics() }))
+	if cfg.API.MetricsPort != 0 {
+		go func() {
+			if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", cfg.API.MetricsPort), nil); err != nil {
+				log.Printf("Failed to serve metrics: %v", err)
+			}
+		}()
+	}
 
 	// gRPC handler setup
 	h := grpchandler.New(ctrl)
@@ -89,3 +110,51 @@ func main() {
 		panic(err)
 	}
 }
+
+type metadataCache interface {
+	Get(ctx context.Context, id string) (*metadatamodel.Metadata, error)
+	Put(ctx context.Context, id string, metadata *metadatamodel.Metadata) error
+}
+
+// newCache creates the metadata cache from the config along with a function returning its usage.
+func newCache(cfg cacheConfig) (metadataCache, func() any, error) {
+	switch cfg.Type {
+	case "", "memory":
+		c := memory.New(cfg.MaxEntries, cfg.TTL)
+		return c, func() any { return c.Stats() }, nil
+	case "redis":
+		client := resp.NewClient(cfg.Redis.Address, cfg.Redis.PoolSize, cfg.Redis.Timeout)
+		c := redis.New(client, cfg.Redis.Namespace, cfg.TTL)
+		return c, func() any { return c.Stats() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cache type %q", cfg.Type)
+	}
+}
+
+// newRegistry creates the service registry from the config.
+// A file registry is reloaded whenever its file changes, until ctx is done.
+func newRegistry(ctx context.Context, cfg serviceDiscoveryConfig) (discovery.Registry, error) {
+	switch cfg.Type {
+	case "", "consul":
+		r, err := consul.NewRegistry(cfg.Consul.Address)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "static":
+		services := map[model.ServiceName][]static.Endpoint{}
+		for name, endpoints := range cfg.Static {
+			services[model.ServiceName(name)] = endpoints
+		}
+		return static.NewRegistry(services), nil
+	case "file":
+		r, err := file.NewRegistry(cfg.File.Path, cfg.File.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		go r.Start(ctx)
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown service discovery type %q", cfg.Type)
+	}
+}
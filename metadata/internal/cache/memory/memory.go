@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/akkahshh24/movieapp/metadata/internal/cache"
+	"github.com/akkahshh24/movieapp/metadata/pkg/model"
+	"github.com/akkahshh24/movieapp/pkg/lru"
+)
+
+// Cache defines a movie metadata cache.
+// It stores metadata in memory, evicting the least recently used entries when full.
+// It is safe for concurrent use.
+type Cache struct {
+	data *lru.Cache[string, model.Metadata]
+}
+
+// New creates a new memory cache holding at most maxEntries movies for ttl each.
+// The number of entries is unbounded if maxEntries is 0, and entries never expire if ttl is 0.
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{data: lru.New[string, model.Metadata](maxEntries, ttl)}
+}
+
+// Get retrieves movie metadata by movie id.
+func (c *Cache) Get(_ context.Context, id string) (*model.Metadata, error) {
+	m, ok := c.data.Get(id)
+	if !ok {
+		return nil, cache.ErrNotFound
+	}
+	return &m, nil
+}
+
+// Put adds movie metadata for a given movie id.
+func (c *Cache) Put(_ context.Context, id string, metadata *model.Metadata) error {
+	c.data.Put(id, *metadata)
+	return nil
+}
+
+// Stats returns the usage of the cache.
+func (c *Cache) Stats() lru.Stats {
+	return c.data.Stats()
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/akkahshh24/movieapp/metadata/internal/cache"
+	"github.com/akkahshh24/movieapp/metadata/pkg/model"
+	"github.com/akkahshh24/movieapp/pkg/resp"
+)
+
+// Cache defines a movie metadata cache stored in Redis or a compatible server, shared by all replicas of the service.
+// Metadata is stored as JSON under keys of the form: namespace:metadata:id.
+type Cache struct {
+	client    *resp.Client
+	namespace string
+	ttl       time.Duration
+
+	hits, misses, errors atomic.Int64
+}
+
+// Stats describes the usage of the cache.
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Errors is the number of commands that failed, for example because the server is unreachable.
+	Errors int64 `json:"errors"`
+}
+
+// New creates a new Redis cache that stores movie metadata under the namespace for ttl each.
+// Entries never expire if ttl is 0.
+func New(client *resp.Client, namespace string, ttl time.Duration) *Cache {
+	return &Cache{client: client, namespace: namespace, ttl: ttl}
+}
+
+// Get retrieves movie metadata by movie id.
+func (c *Cache) Get(ctx context.Context, id string) (*model.Metadata, error) {
+	data, err := c.client.Get(ctx, c.key(id))
+	if errors.Is(err, resp.ErrNil) {
+		c.misses.Add(1)
+		return nil, cache.ErrNotFound
+	} else if err != nil {
+		c.errors.Add(1)
+		return nil, err
+	}
+
+	var m model.Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		c.errors.Add(1)
+		return nil, err
+	}
+	c.hits.Add(1)
+	return &m, nil
+}
+
+// Put adds movie metadata for a given movie id.
+func (c *Cache) Put(ctx context.Context, id string, metadata *model.Metadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, c.key(id), data, c.ttl); err != nil {
+		c.errors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// Stats returns the usage of the cache.
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Errors: c.errors.Load()}
+}
+
+func (c *Cache) key(id string) string {
+	return c.namespace + ":metadata:" + id
+}
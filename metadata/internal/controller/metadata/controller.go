@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/akkahshh24/movieapp/metadata/internal/repository"
 	"github.com/akkahshh24/movieapp/metadata/pkg/model"
+	"github.com/akkahshh24/movieapp/pkg/loader"
 )
 
 // ErrNotFound is returned when a requested record is not found.
@@ -21,13 +23,18 @@ type metadataRepository interface {
 
 // Controller defines a metadata service controller.
 type Controller struct {
-	repo  metadataRepository
-	cache metadataRepository
+	repo   metadataRepository
+	cache  metadataRepository
+	loader *loader.Loader[*model.Metadata]
 }
 
+// maxMissing is the number of ids that are remembered as missing at most.
+const maxMissing = 10000
+
 // New creates a metadata service controller.
-func New(repo metadataRepository, cache metadataRepository) *Controller {
-	return &Controller{repo, cache}
+// Ids that are not found in the repository are remembered as missing for negativeTTL, or not at all if it is 0.
+func New(repo metadataRepository, cache metadataRepository, negativeTTL time.Duration) *Controller {
+	return &Controller{repo, cache, loader.New[*model.Metadata](ErrNotFound, negativeTTL, maxMissing)}
 }
 
 // Get returns movie metadata by id.
@@ -39,24 +46,34 @@ func (c *Controller) Get(ctx context.Context, id string) (*model.Metadata, error
 		return cacheRes, nil
 	}
 
-	// Get the metadata from the repository.
-	res, err := c.repo.Get(ctx, id)
-	if err != nil && errors.Is(err, repository.ErrNotFound) {
-		return nil, ErrNotFound
-	} else if err != nil {
-		return nil, err
-	}
-
-	// Update the cache with the retrieved metadata.
-	if err := c.cache.Put(ctx, id, res); err != nil {
-		log.Println("Error updating cache: " + err.Error())
-	}
+	// Concurrent misses for the same id share a single read of the repository.
+	return c.loader.Load(ctx, id, func(ctx context.Context) (*model.Metadata, error) {
+		// Get the metadata from the repository.
+		res, err := c.repo.Get(ctx, id)
+		if err != nil && errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}, func(ctx context.Context, res *model.Metadata) {
+		// Update the cache with the retrieved metadata.
+		if err := c.cache.Put(ctx, id, res); err != nil {
+			log.Println("Error updating cache: " + err.Error())
+		}
+	})
+}
 
-	return res, err
+// LoaderMetrics returns how many repository reads were avoided on cache misses.
+func (c *Controller) LoaderMetrics() loader.Metrics {
+	return c.loader.Metrics()
 }
 
 // Put writes movie metadata to repository.
 func (c *Controller) Put(ctx context.Context, m *model.Metadata) error {
+	// Loads of the metadata in the meantime must not cache the previous version.
+	defer c.loader.Write(m.ID)()
+
 	if err := c.repo.Put(ctx, m.ID, m); err != nil {
 		return fmt.Errorf("failed to put metadata: %w", err)
 	}
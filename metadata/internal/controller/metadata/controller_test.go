@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	gen "github.com/akkahshh24/movieapp/gen/mock/metadata/repository"
 	"github.com/akkahshh24/movieapp/metadata/internal/repository"
@@ -61,7 +62,7 @@ func TestGet(t *testing.T) {
 
 			repoMock := gen.NewMockmetadataRepository(ctrl)
 			cacheMock := gen.NewMockmetadataRepository(ctrl)
-			c := New(repoMock, cacheMock)
+			c := New(repoMock, cacheMock, 0)
 
 			ctx := context.Background()
 			id := "id"
@@ -71,11 +72,12 @@ func TestGet(t *testing.T) {
 
 			// If cache hit, repo shouldn't be called
 			if tt.expCacheErr != nil {
-				repoMock.EXPECT().Get(ctx, id).Return(tt.expRepoRes, tt.expRepoErr)
+				// The repository is read with a context that outlives the call, as other calls may share the read.
+				repoMock.EXPECT().Get(gomock.Any(), id).Return(tt.expRepoRes, tt.expRepoErr)
 
 				// If repo succeeds, cache should be updated
 				if tt.expRepoErr == nil {
-					cacheMock.EXPECT().Put(ctx, id, tt.expRepoRes).Return(nil)
+					cacheMock.EXPECT().Put(gomock.Any(), id, tt.expRepoRes).Return(nil)
 				}
 			}
 
@@ -85,3 +87,35 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRemembersMissingIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := gen.NewMockmetadataRepository(ctrl)
+	cacheMock := gen.NewMockmetadataRepository(ctrl)
+	c := New(repoMock, cacheMock, time.Minute)
+
+	ctx := context.Background()
+	id := "id"
+	m := &model.Metadata{ID: id}
+
+	// The repository is read only once for an id that does not exist.
+	cacheMock.EXPECT().Get(ctx, id).Return(nil, repository.ErrNotFound).Times(3)
+	repoMock.EXPECT().Get(gomock.Any(), id).Return(nil, repository.ErrNotFound)
+	for range 2 {
+		_, err := c.Get(ctx, id)
+		assert.Equal(t, ErrNotFound, err)
+	}
+	assert.Equal(t, int64(1), c.LoaderMetrics().NegativeHits)
+
+	// Putting the metadata forgets that the id was missing.
+	repoMock.EXPECT().Put(ctx, id, m).Return(nil)
+	cacheMock.EXPECT().Put(ctx, id, m).Return(nil)
+	assert.NoError(t, c.Put(ctx, m))
+	repoMock.EXPECT().Get(gomock.Any(), id).Return(m, nil)
+	cacheMock.EXPECT().Put(gomock.Any(), id, m).Return(nil)
+	res, err := c.Get(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, m, res)
+}
@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"github.com/akkahshh24/movieapp/gen"
+	cachememory "github.com/akkahshh24/movieapp/metadata/internal/cache/memory"
 	"github.com/akkahshh24/movieapp/metadata/internal/controller/metadata"
 	grpchandler "github.com/akkahshh24/movieapp/metadata/internal/handler/grpc"
 	"github.com/akkahshh24/movieapp/metadata/internal/repository/memory"
@@ -10,7 +11,7 @@ import (
 // NewTestMetadataGRPCServer creates a new metadata gRPC server to be used in tests.
 func NewTestMetadataGRPCServer() gen.MetadataServiceServer {
 	repo := memory.New()
-	cache := memory.New()
-	ctrl := metadata.New(repo, cache)
+	cache := cachememory.New(0, 0)
+	ctrl := metadata.New(repo, cache, 0)
 	return grpchandler.New(ctrl)
 }
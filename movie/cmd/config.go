@@ -1,8 +1,15 @@
 package main
 
+import (
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
+)
+
 type config struct {
 	API              apiConfig              `yaml:"api"`
 	ServiceDiscovery serviceDiscoveryConfig `yaml:"serviceDiscovery"`
+	Gateways         gatewaysConfig         `yaml:"gateways"`
 }
 
 type apiConfig struct {
@@ -10,10 +17,44 @@ type apiConfig struct {
 }
 
 type serviceDiscoveryConfig struct {
-	Name   string       `yaml:"name"`
-	Consul consulConfig `yaml:"consul"`
+	// Type is the service registry: consul, static, with the instances listed in the config, or file,
+	// with the instances listed in a file that is reloaded when it changes.
+	Type string `yaml:"type"`
+	Name string `yaml:"name"`
+	// Metadata is registered along with the service instance, for example its version and zone.
+	// Each entry is also a tag of the instance, in the form key=value.
+	Metadata map[string]string `yaml:"metadata"`
+	Consul   consulConfig      `yaml:"consul"`
+	// Static maps each service to its instances, given as addresses or as mappings with an address and metadata.
+	Static map[string][]static.Endpoint `yaml:"static"`
+	File   registryFileConfig           `yaml:"file"`
+}
+
+// registryFileConfig defines a YAML or JSON file mapping each service to its instances, like the static config.
+type registryFileConfig struct {
+	Path         string        `yaml:"path"`
+	PollInterval time.Duration `yaml:"pollInterval"`
 }
 
 type consulConfig struct {
 	Address string `yaml:"address"`
 }
+
+type gatewaysConfig struct {
+	Metadata gatewayConfig `yaml:"metadata"`
+	Rating   gatewayConfig `yaml:"rating"`
+}
+
+type gatewayConfig struct {
+	// Tags filter the instances of the service that are called, for example version=v1 or zone=a.
+	Tags   []string     `yaml:"tags"`
+	Canary canaryConfig `yaml:"canary"`
+}
+
+type canaryConfig struct {
+	// Tags identify the canary instances of the service, for example version=v2.
+	// They must give another value to a key of the gateway tags, so that only the canary instances have them.
+	Tags []string `yaml:"tags"`
+	// Percent is the percentage of the calls sent to the canary instances. They are not used if 0.
+	Percent int `yaml:"percent"`
+}
@@ -9,12 +9,15 @@ import (
 	"time"
 
 	"github.com/akkahshh24/movieapp/gen"
+	"github.com/akkahshh24/movieapp/internal/grpcutil"
 	"github.com/akkahshh24/movieapp/movie/internal/controller/movie"
 	metadatagateway "github.com/akkahshh24/movieapp/movie/internal/gateway/metadata/grpc"
 	ratinggateway "github.com/akkahshh24/movieapp/movie/internal/gateway/rating/grpc"
 	grpchandler "github.com/akkahshh24/movieapp/movie/internal/handler/grpc"
 	"github.com/akkahshh24/movieapp/pkg/discovery"
 	"github.com/akkahshh24/movieapp/pkg/discovery/consul"
+	"github.com/akkahshh24/movieapp/pkg/discovery/file"
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
 	"github.com/akkahshh24/movieapp/pkg/model"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -35,21 +38,18 @@ func main() {
 	port := cfg.API.Port
 	log.Printf("Starting the movie service on port %d", port)
 
-	// Create a new Consul registry instance.
-	// This registry will be used to discover other services in the system.
-	// It connects to a Consul agent running on localhost at port 8500.
-	// The registry is responsible for service registration and discovery.
-	// It allows the movie service to find and communicate with other services like metadata and rating.
-	registry, err := consul.NewRegistry(cfg.ServiceDiscovery.Consul.Address)
+	// Create the service registry, Consul by default.
+	// It is used both to register this service and to discover the other services.
+	ctx := context.Background()
+	registry, err := newRegistry(ctx, cfg.ServiceDiscovery)
 	if err != nil {
 		panic(err)
 	}
 
 	// Register the movie service
-	ctx := context.Background()
 	serviceName := model.ServiceName(cfg.ServiceDiscovery.Name)
 	instanceID := discovery.GenerateInstanceID(serviceName)
-	if err := registry.Register(ctx, instanceID, serviceName, fmt.Sprintf("%s:%d", serviceName, port)); err != nil {
+	if err := registry.Register(ctx, instanceID, serviceName, fmt.Sprintf("%s:%d", serviceName, port), cfg.ServiceDiscovery.Metadata); err != nil {
 		panic(err)
 	}
 
@@ -66,8 +66,20 @@ func main() {
 	// Deregister the service on exit
 	defer registry.Deregister(ctx, instanceID, serviceName)
 
-	metadataGateway := metadatagateway.New(registry)
-	ratingGateway := ratinggateway.New(registry)
+	// The gateways hold a connection to each service, which is shared by all requests.
+	metadataGateway, err := metadatagateway.New(registry, cfg.Gateways.Metadata.Tags)
+	if err != nil {
+		log.Fatalf("failed to connect to the metadata service: %v", err)
+	}
+	defer metadataGateway.Close()
+	ratingGateway, err := ratinggateway.New(registry, cfg.Gateways.Rating.Tags, grpcutil.Canary{
+		Tags:    cfg.Gateways.Rating.Canary.Tags,
+		Percent: cfg.Gateways.Rating.Canary.Percent,
+	})
+	if err != nil {
+		log.Fatalf("failed to connect to the rating service: %v", err)
+	}
+	defer ratingGateway.Close()
 	ctrl := movie.New(ratingGateway, metadataGateway)
 
 	// Create a gRPC server and register the movie service.
@@ -85,3 +97,31 @@ func main() {
 		panic(err)
 	}
 }
+
+// newRegistry creates the service registry from the config.
+// A file registry is reloaded whenever its file changes, until ctx is done.
+func newRegistry(ctx context.Context, cfg serviceDiscoveryConfig) (discovery.Registry, error) {
+	switch cfg.Type {
+	case "", "consul":
+		r, err := consul.NewRegistry(cfg.Consul.Address)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "static":
+		services := map[model.ServiceName][]static.Endpoint{}
+		for name, endpoints := range cfg.Static {
+			services[model.ServiceName(name)] = endpoints
+		}
+		return static.NewRegistry(services), nil
+	case "file":
+		r, err := file.NewRegistry(cfg.File.Path, cfg.File.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		go r.Start(ctx)
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown service discovery type %q", cfg.Type)
+	}
+}
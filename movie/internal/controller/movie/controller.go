@@ -14,7 +14,7 @@ import (
 var ErrNotFound = errors.New("movie metadata not found")
 
 type ratingGateway interface {
-	GetAggregatedRating(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType) (float64, error)
+	GetAggregatedRating(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType) (*ratingmodel.AggregatedRating, error)
 	PutRating(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType, rating *ratingmodel.Rating) error
 }
 
@@ -51,7 +51,10 @@ func (c *Controller) Get(ctx context.Context, id string) (*model.MovieDetails, e
 	} else if err != nil {
 		return nil, err
 	} else {
-		details.Rating = &rating
+		details.Rating = &rating.Value
+		details.RatingCount = rating.Count
+		details.RatingSum = rating.Sum
+		details.RatingHistogram = rating.Histogram
 	}
 
 	return details, nil
@@ -7,33 +7,34 @@ import (
 	"github.com/akkahshh24/movieapp/internal/grpcutil"
 	"github.com/akkahshh24/movieapp/metadata/pkg/model"
 	"github.com/akkahshh24/movieapp/pkg/discovery"
+	"google.golang.org/grpc"
 )
 
 // Gateway defines a movie metadata gRPC gateway.
 type Gateway struct {
-	registry discovery.Registry
+	conn *grpc.ClientConn
 }
 
 // New creates a new gRPC gateway for a movie metadata service.
-func New(registry discovery.Registry) *Gateway {
-	return &Gateway{registry}
-}
-
-// Get returns movie metadata by a movie id.
-func (g *Gateway) Get(ctx context.Context, id string) (*model.Metadata, error) {
-	// Create a gRPC connection to the metadata service.
-	// This will select a random service instance from the registry.
-	conn, err := grpcutil.ServiceConnection(ctx, "metadata", g.registry)
+// It holds a single connection to all metadata service instances found in the registry having all the given tags.
+func New(registry discovery.Registry, tags []string) (*Gateway, error) {
+	conn, err := grpcutil.ServiceConnection("metadata", registry, tags...)
 	if err != nil {
 		return nil, err
 	}
-	// Close the connection when done.
-	// This is important to avoid resource leaks.
-	defer conn.Close()
+	return &Gateway{conn}, nil
+}
 
+// Close closes the connection to the metadata service.
+func (g *Gateway) Close() error {
+	return g.conn.Close()
+}
+
+// Get returns movie metadata by a movie id.
+func (g *Gateway) Get(ctx context.Context, id string) (*model.Metadata, error) {
 	// Create a gRPC client for the metadata service.
 	// This client will be used to call the GetMetadata method.
-	client := gen.NewMetadataServiceClient(conn)
+	client := gen.NewMetadataServiceClient(g.conn)
 	resp, err := client.GetMetadata(ctx, &gen.GetMetadataRequest{MovieId: id})
 	if err != nil {
 		return nil, err
@@ -12,47 +12,41 @@ import (
 
 // Gateway defines an gRPC gateway for a rating service.
 type Gateway struct {
-	registry discovery.Registry
+	conn *grpcutil.CanaryConnection
 }
 
 // New creates a new gRPC gateway for a rating service.
-func New(registry discovery.Registry) *Gateway {
-	return &Gateway{registry}
-}
-
-// GetAggregatedRating returns the aggregated rating for a record or ErrNotFound if there are no ratings for it.
-func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (float64, error) {
-	// Create a gRPC connection to the rating service.
-	// This will select a random service instance from the registry.
-	conn, err := grpcutil.ServiceConnection(ctx, "rating", g.registry)
+// It holds a single connection to all rating service instances found in the registry having all the given tags,
+// which sends a percentage of the calls to the canary instances, if any.
+func New(registry discovery.Registry, tags []string, canary grpcutil.Canary) (*Gateway, error) {
+	conn, err := grpcutil.NewCanaryConnection("rating", registry, tags, canary)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	// Close the connection when done.
-	// This is important to avoid resource leaks.
-	defer conn.Close()
+	return &Gateway{conn}, nil
+}
+
+// Close closes the connection to the rating service.
+func (g *Gateway) Close() error {
+	return g.conn.Close()
+}
 
+// GetAggregatedRating returns the aggregated rating for a record or ErrNotFound if there are no ratings for it.
+func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
 	// Create a gRPC client for the rating service.
 	// This client will be used to call the GetAggregatedRating method.
-	client := gen.NewRatingServiceClient(conn)
+	client := gen.NewRatingServiceClient(g.conn)
 	resp, err := client.GetAggregatedRating(ctx, &gen.GetAggregatedRatingRequest{RecordId: string(recordID), RecordType: string(recordType)})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return resp.RatingValue, nil
+	return model.ProtoToAggregatedRating(resp), nil
 }
 
 func (g *Gateway) PutRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *ratingmodel.Rating) error {
-	// Create a gRPC connection to the rating service.
-	conn, err := grpcutil.ServiceConnection(ctx, "rating", g.registry)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
 	// Create a gRPC client for the rating service.
-	client := gen.NewRatingServiceClient(conn)
-	_, err = client.PutRating(ctx, &gen.PutRatingRequest{
+	client := gen.NewRatingServiceClient(g.conn)
+	_, err := client.PutRating(ctx, &gen.PutRatingRequest{
 		RecordId:    string(recordID),
 		RecordType:  string(recordType),
 		RatingValue: int32(rating.Value),
@@ -25,10 +25,10 @@ func New(registry discovery.Registry) *Gateway {
 }
 
 // GetAggregatedRating returns the aggregated rating for a record or ErrNotFound if there are no ratings for it.
-func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (float64, error) {
+func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
 	endpoints, err := g.registry.ServiceEndpoints(ctx, constant.ServiceNameRating)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	url := "http://" + endpoints[rand.Intn(len(endpoints))] + "/rating"
@@ -36,7 +36,7 @@ func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.Record
 
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	req = req.WithContext(ctx)
@@ -46,19 +46,19 @@ func (g *Gateway) GetAggregatedRating(ctx context.Context, recordID model.Record
 	req.URL.RawQuery = values.Encode()
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
-		return 0, gateway.ErrNotFound
+		return nil, gateway.ErrNotFound
 	} else if resp.StatusCode/100 != 2 {
-		return 0, fmt.Errorf("non-2xx response: %v", resp)
+		return nil, fmt.Errorf("non-2xx response: %v", resp)
 	}
 
-	var v float64
+	var v *model.AggregatedRating
 	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
-		return 0, err
+		return nil, err
 	}
 	return v, nil
 }
@@ -41,10 +41,17 @@ func (h *Handler) GetMovieDetails(ctx context.Context, req *gen.GetMovieDetailsR
 	if m.Rating != nil {
 		rating = *m.Rating
 	}
+	histogram := make(map[int32]int64, len(m.RatingHistogram))
+	for v, n := range m.RatingHistogram {
+		histogram[int32(v)] = n
+	}
 	return &gen.GetMovieDetailsResponse{
 		MovieDetails: &gen.MovieDetails{
-			Metadata: m.Metadata.ToProto(),
-			Rating:   rating,
+			Metadata:        m.Metadata.ToProto(),
+			Rating:          rating,
+			RatingCount:     m.RatingCount,
+			RatingSum:       m.RatingSum,
+			RatingHistogram: histogram,
 		},
 	}, nil
 }
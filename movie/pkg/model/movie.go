@@ -1,9 +1,15 @@
 package model
 
-import "github.com/akkahshh24/movieapp/metadata/pkg/model"
+import (
+	"github.com/akkahshh24/movieapp/metadata/pkg/model"
+	ratingmodel "github.com/akkahshh24/movieapp/rating/pkg/model"
+)
 
 // MovieDetails includes movie metadata its aggregated rating.
 type MovieDetails struct {
-	Rating   *float64       `json:"rating,omitempty"`
-	Metadata model.Metadata `json:"metadata"`
+	Rating          *float64                          `json:"rating,omitempty"`
+	RatingCount     int64                             `json:"ratingCount,omitempty"`
+	RatingSum       int64                             `json:"ratingSum,omitempty"`
+	RatingHistogram map[ratingmodel.RatingValue]int64 `json:"ratingHistogram,omitempty"`
+	Metadata        model.Metadata                    `json:"metadata"`
 }
@@ -2,6 +2,7 @@ package testutil
 
 import (
 	"github.com/akkahshh24/movieapp/gen"
+	"github.com/akkahshh24/movieapp/internal/grpcutil"
 	"github.com/akkahshh24/movieapp/movie/internal/controller/movie"
 	metadatagateway "github.com/akkahshh24/movieapp/movie/internal/gateway/metadata/grpc"
 	ratinggateway "github.com/akkahshh24/movieapp/movie/internal/gateway/rating/grpc"
@@ -11,8 +12,14 @@ import (
 
 // NewTestMovieGRPCServer creates a new movie gRPC server to be used in tests.
 func NewTestMovieGRPCServer(registry discovery.Registry) gen.MovieServiceServer {
-	metadataGateway := metadatagateway.New(registry)
-	ratingGateway := ratinggateway.New(registry)
+	metadataGateway, err := metadatagateway.New(registry, nil)
+	if err != nil {
+		panic(err)
+	}
+	ratingGateway, err := ratinggateway.New(registry, nil, grpcutil.Canary{})
+	if err != nil {
+		panic(err)
+	}
 	ctrl := movie.New(ratingGateway, metadataGateway)
 	return grpchandler.New(ctrl)
 }
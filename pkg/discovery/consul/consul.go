@@ -4,17 +4,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/akkahshh24/movieapp/pkg/discovery"
 	"github.com/akkahshh24/movieapp/pkg/model"
 	consul "github.com/hashicorp/consul/api"
 )
 
+// Watches use blocking queries that wait up to watchWaitTime for a change.
+// Failed queries are retried with an exponential backoff.
+const (
+	watchWaitTime     = 5 * time.Minute
+	watchMinBackoff   = 500 * time.Millisecond
+	watchMaxBackoff   = 30 * time.Second
+	watchDebounceTime = 100 * time.Millisecond
+)
+
 // Registry defines a Consul-based service regisry.
+// The metadata of an instance is registered both as Consul service meta and as tags in the form key=value.
+// It keeps the last known addresses of each service and set of tags, which are served while Consul is unreachable.
 type Registry struct {
 	client *consul.Client
+
+	mu        sync.RWMutex
+	lastKnown map[string][]string
 }
 
 // NewRegistry creates a new Consul-based service registry instance.
@@ -25,11 +43,11 @@ func NewRegistry(addr string) (*Registry, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Registry{client: client}, nil
+	return &Registry{client: client, lastKnown: map[string][]string{}}, nil
 }
 
 // Register creates a service record in the registry.
-func (r *Registry) Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string) error {
+func (r *Registry) Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string, metadata model.InstanceMetadata) error {
 	parts := strings.Split(hostPort, ":")
 	if len(parts) != 2 {
 		return errors.New("hostPort must be in a form of <host>:<port>, example: localhost:8081")
@@ -43,6 +61,8 @@ func (r *Registry) Register(ctx context.Context, instanceID model.InstanceID, se
 		ID:      instanceID.String(),
 		Name:    serviceName.String(),
 		Port:    port,
+		Tags:    metadata.Tags(),
+		Meta:    metadata,
 		Check:   &consul.AgentServiceCheck{CheckID: instanceID.String(), TTL: "5s"},
 	})
 }
@@ -52,22 +72,117 @@ func (r *Registry) Deregister(ctx context.Context, instanceID model.InstanceID,
 	return r.client.Agent().ServiceDeregister(instanceID.String())
 }
 
-// ServiceAddresses returns the list of addresses of active instances of the given service.
-func (r *Registry) ServiceEndpoints(ctx context.Context, serviceName model.ServiceName) ([]string, error) {
-	entries, _, err := r.client.Health().Service(serviceName.String(), "", true, nil)
+// ServiceAddresses returns the list of addresses of active instances of the given service having all the given tags.
+// The last known addresses are returned if Consul is unreachable.
+func (r *Registry) ServiceEndpoints(ctx context.Context, serviceName model.ServiceName, tags ...string) ([]string, error) {
+	key := lastKnownKey(serviceName, tags)
+	entries, _, err := r.client.Health().ServiceMultipleTags(serviceName.String(), tags, true, (&consul.QueryOptions{}).WithContext(ctx))
 	if err != nil {
+		if res, ok := r.lastKnownEndpoints(key); ok && ctx.Err() == nil {
+			log.Printf("Failed to query Consul, using the last known addresses of service %s: %v", serviceName, err)
+			return res, nil
+		}
 		return nil, err
-	} else if len(entries) == 0 {
-		return nil, discovery.ErrNotFound
 	}
-	var res []string
-	for _, e := range entries {
-		res = append(res, fmt.Sprintf("%s:%d", e.Service.Address, e.Service.Port))
+	res := r.updateEndpoints(key, entries)
+	if len(res) == 0 {
+		return nil, discovery.ErrNotFound
 	}
 	return res, nil
 }
 
+// Watch streams the addresses of active instances of the given service having all the given tags whenever they change.
+// It uses Consul blocking queries. While Consul is unreachable, no change is sent, so watchers keep using
+// the last known addresses. If no address is known yet, the failure is sent instead.
+func (r *Registry) Watch(ctx context.Context, serviceName model.ServiceName, tags ...string) (<-chan discovery.Update, error) {
+	key := lastKnownKey(serviceName, tags)
+	updates := make(chan discovery.Update)
+	go func() {
+		defer close(updates)
+		// sent reports whether watchers have been sent anything, addresses or an error.
+		var sent bool
+		if res, ok := r.lastKnownEndpoints(key); ok {
+			select {
+			case updates <- discovery.Update{Endpoints: res}:
+				sent = true
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		var index uint64
+		backoff := watchMinBackoff
+		for {
+			opts := (&consul.QueryOptions{WaitIndex: index, WaitTime: watchWaitTime}).WithContext(ctx)
+			entries, meta, err := r.client.Health().ServiceMultipleTags(serviceName.String(), tags, true, opts)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to watch service %s, retrying in %v: %v", serviceName, backoff, err)
+				if !sent {
+					select {
+					case updates <- discovery.Update{Err: fmt.Errorf("watch service %s: %w", serviceName, err)}:
+						sent = true
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return
+				}
+				backoff = min(2*backoff, watchMaxBackoff)
+				continue
+			}
+			backoff = watchMinBackoff
+
+			// The index goes backwards if Consul has been reset, in which case the query starts over.
+			// It is never 0 though, as a query with index 0 does not block and would poll Consul in a tight loop.
+			if meta.LastIndex < index {
+				index = 1
+			} else {
+				index = max(meta.LastIndex, 1)
+			}
+			select {
+			case updates <- discovery.Update{Endpoints: r.updateEndpoints(key, entries)}:
+				sent = true
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return discovery.Debounce(ctx, updates, watchDebounceTime), nil
+}
+
 // ReportHealthyState is a push mechanism for reporting healthy state to the registry.
 func (r *Registry) ReportHealthyState(instanceID model.InstanceID, _ model.ServiceName) error {
 	return r.client.Agent().PassTTL(instanceID.String(), "")
 }
+
+// lastKnownKey returns the key of the last known addresses of a service having all the given tags.
+func lastKnownKey(serviceName model.ServiceName, tags []string) string {
+	return serviceName.String() + "?" + strings.Join(slices.Sorted(slices.Values(tags)), ",")
+}
+
+// updateEndpoints records the addresses of the healthy instances of a service as the last known ones and returns them.
+func (r *Registry) updateEndpoints(key string, entries []*consul.ServiceEntry) []string {
+	var res []string
+	for _, e := range entries {
+		res = append(res, fmt.Sprintf("%s:%d", e.Service.Address, e.Service.Port))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastKnown[key] = res
+	return res
+}
+
+// lastKnownEndpoints returns the last known addresses of a service, if any.
+func (r *Registry) lastKnownEndpoints(key string) ([]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, ok := r.lastKnown[key]
+	return res, ok && len(res) > 0
+}
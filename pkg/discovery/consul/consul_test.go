@@ -0,0 +1,131 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery"
+	"github.com/akkahshh24/movieapp/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchServesLastKnownEndpoints(t *testing.T) {
+	// The fake Consul knows one instance, then two, then becomes unreachable.
+	var queries atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch queries.Add(1) {
+		case 1:
+			w.Header().Set("X-Consul-Index", "1")
+			w.Write([]byte(`[{"Service": {"Address": "10.0.0.2", "Port": 8082}}]`))
+		case 2:
+			assert.Equal(t, "1", req.URL.Query().Get("index"))
+			w.Header().Set("X-Consul-Index", "2")
+			w.Write([]byte(`[{"Service": {"Address": "10.0.0.2", "Port": 8082}}, {"Service": {"Address": "10.0.0.1", "Port": 8082}}]`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewRegistry(srv.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := r.Watch(ctx, "rating")
+	require.NoError(t, err)
+	want := []string{"10.0.0.1:8082", "10.0.0.2:8082"}
+	// Both sets arrive within the debounce window, so only the latest one is sent.
+	select {
+	case got := <-updates:
+		assert.Equal(t, discovery.Update{Endpoints: want}, got)
+	case <-time.After(time.Second):
+		t.Fatal("no update")
+	}
+
+	got, err := r.ServiceEndpoints(ctx, "rating")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+
+	cancel()
+	for range updates {
+	}
+}
+
+func TestWatchSendsErrorWhenNothingIsKnown(t *testing.T) {
+	// The fake Consul fails, then answers with an index of 0, which must not be used for the next query.
+	var queries atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch queries.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			w.Header().Set("X-Consul-Index", "0")
+			w.Write([]byte(`[{"Service": {"Address": "10.0.0.1", "Port": 8082}}]`))
+		default:
+			assert.Equal(t, "1", req.URL.Query().Get("index"))
+			<-req.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewRegistry(srv.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := r.Watch(ctx, "rating")
+	require.NoError(t, err)
+	for _, check := range []func(discovery.Update){
+		func(u discovery.Update) { assert.Error(t, u.Err) },
+		func(u discovery.Update) { assert.Equal(t, discovery.Update{Endpoints: []string{"10.0.0.1:8082"}}, u) },
+	} {
+		select {
+		case u := <-updates:
+			check(u)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no update")
+		}
+	}
+
+	cancel()
+	for range updates {
+	}
+	assert.Equal(t, int32(3), queries.Load())
+}
+
+func TestRegisterMapsMetadataToTagsAndMeta(t *testing.T) {
+	var registration struct {
+		Tags []string
+		Meta map[string]string
+	}
+	var queriedTags []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/agent/service/register":
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&registration))
+		case "/v1/health/service/rating":
+			queriedTags = req.URL.Query()["tag"]
+			w.Write([]byte(`[{"Service": {"Address": "10.0.0.2", "Port": 8082}}]`))
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewRegistry(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, r.Register(ctx, "rating-1", "rating", "10.0.0.2:8082", model.InstanceMetadata{"version": "v2", "zone": "a"}))
+	assert.Equal(t, []string{"version=v2", "zone=a"}, registration.Tags)
+	assert.Equal(t, map[string]string{"version": "v2", "zone": "a"}, registration.Meta)
+
+	got, err := r.ServiceEndpoints(ctx, "rating", "version=v2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2:8082"}, got)
+	assert.Equal(t, []string{"version=v2"}, queriedTags)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"time"
 
 	"github.com/akkahshh24/movieapp/pkg/model"
@@ -12,14 +13,31 @@ import (
 
 // Registry defines a service registry.
 type Registry interface {
-	// Register creates a service instance record in the registry.
-	Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string) error
+	// Register creates a service instance record in the registry, along with its metadata, which may be nil.
+	Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string, metadata model.InstanceMetadata) error
 	// Deregister removes a service insttance record from the registry.
 	Deregister(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName) error
-	// ServiceEndpoints returns the list of addresses of active instances of the given service.
-	ServiceEndpoints(ctx context.Context, serviceName model.ServiceName) ([]string, error)
+	// ServiceEndpoints returns the list of addresses of active instances of the given service
+	// having all the given tags, for example version=v2.
+	ServiceEndpoints(ctx context.Context, serviceName model.ServiceName, tags ...string) ([]string, error)
 	// ReportHealthyState is a push mechanism for reporting healthy state to the registry.
 	ReportHealthyState(instanceID model.InstanceID, serviceName model.ServiceName) error
+	// Watch streams the addresses of active instances of the given service having all the given tags, sorted,
+	// whenever they change, starting with the current ones. The channel is closed once ctx is done.
+	Watch(ctx context.Context, serviceName model.ServiceName, tags ...string) (<-chan Update, error)
+}
+
+// Update defines a change of the endpoints of a watched service.
+type Update struct {
+	// Endpoints are the addresses of the active instances, sorted. They are empty if there are none.
+	Endpoints []string
+	// Err is set instead of the endpoints if the registry cannot be reached and the endpoints are unknown.
+	Err error
+}
+
+// equal checks whether two updates report the same endpoints or both report an error.
+func (u Update) equal(other Update) bool {
+	return (u.Err == nil) == (other.Err == nil) && slices.Equal(u.Endpoints, other.Endpoints)
 }
 
 // ErrNotFound is returned when no service addresses are found.
@@ -30,3 +48,50 @@ var ErrNotFound = errors.New("no service addresses found")
 func GenerateInstanceID(serviceName model.ServiceName) model.InstanceID {
 	return model.InstanceID(fmt.Sprintf("%s-%d", serviceName, rand.New(rand.NewSource(time.Now().UnixNano())).Int()))
 }
+
+// Debounce forwards the updates received from in once no other update has arrived within window,
+// with sorted endpoints and skipping those equal to the last one forwarded. The returned channel is
+// closed once in is closed, after forwarding the update still pending if any, or once ctx is done.
+func Debounce(ctx context.Context, in <-chan Update, window time.Duration) <-chan Update {
+	out := make(chan Update)
+	go func() {
+		defer close(out)
+		var last, pending Update
+		var sent bool
+		var timer <-chan time.Time
+		// flush forwards the pending update unless it is equal to the last one, and reports whether ctx is still active.
+		flush := func() bool {
+			timer = nil
+			if sent && pending.equal(last) {
+				return true
+			}
+			select {
+			case out <- pending:
+				last, sent = pending, true
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			select {
+			case u, ok := <-in:
+				if !ok {
+					if timer != nil {
+						flush()
+					}
+					return
+				}
+				pending = Update{Endpoints: slices.Sorted(slices.Values(u.Endpoints)), Err: u.Err}
+				timer = time.After(window)
+			case <-timer:
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
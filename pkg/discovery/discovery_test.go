@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebounce(t *testing.T) {
+	in := make(chan Update)
+	out := Debounce(context.Background(), in, time.Hour)
+
+	// Updates arriving within the window are coalesced, and the last one is still forwarded when in is closed.
+	in <- Update{Endpoints: []string{"b", "a"}}
+	in <- Update{Endpoints: []string{"c", "a"}}
+	close(in)
+	assert.Equal(t, Update{Endpoints: []string{"a", "c"}}, <-out)
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func TestDebounceSkipsEqualUpdates(t *testing.T) {
+	in := make(chan Update)
+	out := Debounce(context.Background(), in, time.Millisecond)
+
+	in <- Update{Endpoints: []string{"a"}}
+	assert.Equal(t, Update{Endpoints: []string{"a"}}, <-out)
+	// An update equal to the last one forwarded is not forwarded again, even when in is closed.
+	in <- Update{Endpoints: []string{"a"}}
+	close(in)
+	_, ok := <-out
+	assert.False(t, ok)
+}
@@ -0,0 +1,94 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
+	"github.com/akkahshh24/movieapp/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+// errNoServices is returned when the file does not list any service.
+var errNoServices = errors.New("no services found in the file")
+
+// defaultPollInterval is how often the file is checked for changes if no interval is given.
+const defaultPollInterval = time.Second
+
+// Registry defines a service registry whose instances are read from a file, which is reloaded when it changes.
+// The file maps each service to its instances, in YAML or JSON, for example:
+//
+//	rating:
+//	  - localhost:8082
+//	  - address: localhost:8085
+//	    metadata: {version: v2}
+type Registry struct {
+	*static.Registry
+	path         string
+	pollInterval time.Duration
+	modTime      time.Time
+	size         int64
+}
+
+// NewRegistry creates a new service registry instance with the instances read from a file, which must list at least one service,
+// which is checked for changes every pollInterval, or every second if 0, once the registry is started.
+func NewRegistry(path string, pollInterval time.Duration) (*Registry, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	r := &Registry{Registry: static.NewRegistry(nil), path: path, pollInterval: pollInterval}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Start reloads the file whenever it changes, until ctx is done.
+// The instances are kept unchanged while the file cannot be read, is invalid or lists no service.
+// Writers should replace the file atomically, for example by renaming a temporary file over it.
+func (r *Registry) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if reloaded, err := r.reload(); err != nil {
+				log.Printf("Failed to reload the service registry file %s: %v", r.path, err)
+			} else if reloaded {
+				log.Printf("Reloaded the service registry file %s", r.path)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload reads the file if it has changed since it was last read and reports whether it did.
+func (r *Registry) reload() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	// YAML is a superset of JSON, so both are decoded the same way.
+	var services map[model.ServiceName][]static.Endpoint
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return false, err
+	}
+	// An empty document is most likely a file being written, which must not wipe out all instances.
+	if len(services) == 0 {
+		return false, errNoServices
+	}
+	r.Set(services)
+	r.modTime, r.size = info.ModTime(), info.Size()
+	return true, nil
+}
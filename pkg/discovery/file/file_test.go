@@ -0,0 +1,76 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile replaces a file atomically, as a partially written file may be read otherwise.
+func writeFile(t *testing.T, path, data string) {
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(data), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func TestRegistryReloadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	writeFile(t, path, `
+rating:
+  - localhost:8082
+  - address: localhost:8085
+    metadata: {version: v2}
+`)
+	r, err := NewRegistry(path, 10*time.Millisecond)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(stopped)
+	}()
+
+	addrs, err := r.ServiceEndpoints(ctx, "rating")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:8082", "localhost:8085"}, addrs)
+	addrs, err = r.ServiceEndpoints(ctx, "rating", "version=v2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:8085"}, addrs)
+	_, err = r.ServiceEndpoints(ctx, "metadata")
+	assert.ErrorIs(t, err, discovery.ErrNotFound)
+
+	updates, err := r.Watch(ctx, "rating")
+	require.NoError(t, err)
+	assert.Equal(t, discovery.Update{Endpoints: []string{"localhost:8082", "localhost:8085"}}, <-updates)
+
+	// JSON is accepted too.
+	writeFile(t, path, `{"rating": ["localhost:8086"], "metadata": [{"address": "localhost:8081"}]}`)
+	select {
+	case u := <-updates:
+		assert.Equal(t, discovery.Update{Endpoints: []string{"localhost:8086"}}, u)
+	case <-time.After(time.Second):
+		t.Fatal("no update")
+	}
+	addrs, err = r.ServiceEndpoints(ctx, "metadata")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:8081"}, addrs)
+
+	// Invalid and empty files are ignored. The file is reloaded by the test from now on.
+	cancel()
+	<-stopped
+	for _, data := range []string{`rating: [`, ``, `{}`} {
+		writeFile(t, path, data)
+		_, err := r.reload()
+		assert.Error(t, err)
+		addrs, err = r.ServiceEndpoints(ctx, "rating")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"localhost:8086"}, addrs)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"maps"
 	"sync"
 	"time"
 
@@ -11,69 +12,257 @@ import (
 	"github.com/akkahshh24/movieapp/pkg/model"
 )
 
+// By default, an instance is passing for 5 seconds after it last reported a healthy state,
+// then warning for 30 more seconds, after which it is critical.
+const (
+	defaultTTL         = 5 * time.Second
+	defaultGracePeriod = 30 * time.Second
+)
+
+// tombstoneTTL defines how long a removed critical instance is remembered, so that it can come back
+// by reporting a healthy state again.
+const tombstoneTTL = 24 * time.Hour
+
+// debounceWindow defines how long the changes of a watched service are collected before they are sent.
+const debounceWindow = 50 * time.Millisecond
+
 // Registry defines an in-memory service regisry.
-// Note: this registry does not perform health monitoring of active instances.
+// Only passing instances are returned as endpoints. Critical instances are removed by the reaper, see StartReaper.
 type Registry struct {
 	sync.RWMutex
 	serviceAddrs map[model.ServiceName]map[model.InstanceID]*model.ServiceInstance
+	// reaped keeps the instances removed by the reaper, which are registered again if they report a healthy state.
+	reaped      map[model.ServiceName]map[model.InstanceID]*model.ServiceInstance
+	ttl         time.Duration
+	gracePeriod time.Duration
+	// changed is closed and replaced whenever the endpoints of a service may have changed,
+	// which wakes up the watchers.
+	changed chan struct{}
 }
 
-// NewRegistry creates a new in-memory service registry instance.
+// NewRegistry creates a new in-memory service registry instance with the default TTL and grace period.
 func NewRegistry() *Registry {
-	return &Registry{serviceAddrs: map[model.ServiceName]map[model.InstanceID]*model.ServiceInstance{}}
+	return NewRegistryWithTTL(defaultTTL, defaultGracePeriod)
+}
+
+// NewRegistryWithTTL creates a new in-memory service registry instance in which an instance is passing for ttl
+// after it last reported a healthy state, then warning for gracePeriod, after which it is critical.
+func NewRegistryWithTTL(ttl, gracePeriod time.Duration) *Registry {
+	return &Registry{
+		serviceAddrs: map[model.ServiceName]map[model.InstanceID]*model.ServiceInstance{},
+		reaped:       map[model.ServiceName]map[model.InstanceID]*model.ServiceInstance{},
+		ttl:          ttl,
+		gracePeriod:  gracePeriod,
+		changed:      make(chan struct{}),
+	}
 }
 
 // Register creates a service record in the registry.
-func (r *Registry) Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string) error {
+func (r *Registry) Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string, metadata model.InstanceMetadata) error {
 	r.Lock()
 	defer r.Unlock()
-	if _, ok := r.serviceAddrs[serviceName]; !ok {
-		r.serviceAddrs[serviceName] = map[model.InstanceID]*model.ServiceInstance{}
-	}
-	r.serviceAddrs[serviceName][instanceID] = &model.ServiceInstance{HostPort: hostPort, LastActive: time.Now()}
+	r.add(&model.ServiceInstance{
+		ServiceName: serviceName,
+		InstanceID:  instanceID,
+		HostPort:    hostPort,
+		Metadata:    maps.Clone(metadata),
+		LastActive:  time.Now(),
+		State:       model.HealthPassing,
+	})
 	return nil
 }
 
+// add adds an instance to the registry, replacing any removed one with the same id.
+// It must be called with the registry locked.
+func (r *Registry) add(instance *model.ServiceInstance) {
+	if _, ok := r.serviceAddrs[instance.ServiceName]; !ok {
+		r.serviceAddrs[instance.ServiceName] = map[model.InstanceID]*model.ServiceInstance{}
+	}
+	r.serviceAddrs[instance.ServiceName][instance.InstanceID] = instance
+	delete(r.reaped[instance.ServiceName], instance.InstanceID)
+	r.notify()
+}
+
 // Deregister removes a service record from the registry.
 func (r *Registry) Deregister(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName) error {
 	r.Lock()
 	defer r.Unlock()
+	delete(r.reaped[serviceName], instanceID)
 	if _, ok := r.serviceAddrs[serviceName]; !ok {
 		return nil
 	}
 	delete(r.serviceAddrs[serviceName], instanceID)
+	r.notify()
 	return nil
 }
 
 // ReportHealthyState is a push mechanism for reporting healthy state to the registry.
+// An instance removed by the reaper is registered again, as it is evidently running.
 func (r *Registry) ReportHealthyState(instanceID model.InstanceID, serviceName model.ServiceName) error {
 	r.Lock()
 	defer r.Unlock()
+	if instance, ok := r.reaped[serviceName][instanceID]; ok {
+		log.Println("Instance " + instanceID.String() + " of service " + serviceName.String() + " is passing again, registering it")
+		instance.LastActive = time.Now()
+		instance.State = model.HealthPassing
+		r.add(instance)
+		return nil
+	}
 	if _, ok := r.serviceAddrs[serviceName]; !ok {
 		return errors.New("instance " + instanceID.String() + " of service " + serviceName.String() + " is not registered yet")
 	}
-	if _, ok := r.serviceAddrs[serviceName][instanceID]; !ok {
+	instance, ok := r.serviceAddrs[serviceName][instanceID]
+	if !ok {
 		return errors.New("service instance is not registered yet")
 	}
-	r.serviceAddrs[serviceName][instanceID].LastActive = time.Now()
+	if r.state(instance, time.Now()) != model.HealthPassing {
+		log.Println("Instance " + instanceID.String() + " of service " + serviceName.String() + " is passing again")
+		r.notify()
+	}
+	instance.LastActive = time.Now()
+	instance.State = model.HealthPassing
 	return nil
 }
 
-// ServiceAddresses returns the list of addresses of active instances of the given service.
-func (r *Registry) ServiceEndpoints(ctx context.Context, serviceName model.ServiceName) ([]string, error) {
+// ServiceAddresses returns the list of addresses of active instances of the given service having all the given tags.
+func (r *Registry) ServiceEndpoints(ctx context.Context, serviceName model.ServiceName, tags ...string) ([]string, error) {
+	r.RLock()
+	defer r.RUnlock()
+	if len(r.serviceAddrs[serviceName]) == 0 {
+		return nil, discovery.ErrNotFound
+	}
+	return r.passingEndpoints(serviceName, tags, time.Now()), nil
+}
+
+// ServiceInstances returns all instances of the given service along with their current health state,
+// for example for debugging.
+func (r *Registry) ServiceInstances(ctx context.Context, serviceName model.ServiceName) ([]model.ServiceInstance, error) {
 	r.RLock()
 	defer r.RUnlock()
 	if len(r.serviceAddrs[serviceName]) == 0 {
 		return nil, discovery.ErrNotFound
 	}
+	now := time.Now()
+	var res []model.ServiceInstance
+	for _, instance := range r.serviceAddrs[serviceName] {
+		i := *instance
+		i.Metadata = maps.Clone(instance.Metadata)
+		i.State = r.state(instance, now)
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+// Watch streams the addresses of active instances of the given service having all the given tags whenever they change.
+func (r *Registry) Watch(ctx context.Context, serviceName model.ServiceName, tags ...string) (<-chan discovery.Update, error) {
+	updates := make(chan discovery.Update)
+	go func() {
+		defer close(updates)
+		// Instances also stop passing without any change to the registry if the reaper is not running,
+		// so they are checked periodically.
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			r.RLock()
+			addrs := r.passingEndpoints(serviceName, tags, time.Now())
+			changed := r.changed
+			r.RUnlock()
+
+			select {
+			case updates <- discovery.Update{Endpoints: addrs}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-changed:
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return discovery.Debounce(ctx, updates, debounceWindow), nil
+}
+
+// StartReaper updates the health state of all instances every interval and removes the critical ones,
+// until ctx is done. A removed instance is registered again if it reports a healthy state within a day.
+func (r *Registry) StartReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.reap(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reap updates the health state of all instances and removes the critical ones.
+func (r *Registry) reap(now time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, instances := range r.reaped {
+		maps.DeleteFunc(instances, func(_ model.InstanceID, instance *model.ServiceInstance) bool {
+			return now.Sub(instance.LastActive) > tombstoneTTL
+		})
+	}
+
+	var changed bool
+	for serviceName, instances := range r.serviceAddrs {
+		for instanceID, instance := range instances {
+			state := r.state(instance, now)
+			if state == instance.State {
+				continue
+			}
+			changed = true
+			if state == model.HealthCritical {
+				log.Println("Instance " + instanceID.String() + " of service " + serviceName.String() + " is critical, removing it")
+				delete(instances, instanceID)
+				if _, ok := r.reaped[serviceName]; !ok {
+					r.reaped[serviceName] = map[model.InstanceID]*model.ServiceInstance{}
+				}
+				instance.State = state
+				r.reaped[serviceName][instanceID] = instance
+				continue
+			}
+			log.Println("Instance " + instanceID.String() + " of service " + serviceName.String() + " is " + string(state))
+			instance.State = state
+		}
+	}
+	if changed {
+		r.notify()
+	}
+}
+
+// passingEndpoints returns the addresses of the passing instances of a service having all the given tags.
+// It must be called with the registry locked.
+func (r *Registry) passingEndpoints(serviceName model.ServiceName, tags []string, now time.Time) []string {
 	var res []string
-	for instanceID, serviceInstance := range r.serviceAddrs[serviceName] {
-		// Only return instances with a successful health check within the last 5 seconds.
-		if serviceInstance.LastActive.Before(time.Now().Add(-5 * time.Second)) {
-			log.Println("Instance " + instanceID.String() + " of service " + serviceName.String() + " is not active, skipping")
-			continue
+	for _, instance := range r.serviceAddrs[serviceName] {
+		if r.state(instance, now) == model.HealthPassing && instance.Metadata.HasTags(tags) {
+			res = append(res, instance.HostPort)
 		}
-		res = append(res, serviceInstance.HostPort)
 	}
-	return res, nil
+	return res
+}
+
+// state returns the health state of an instance at a given time.
+func (r *Registry) state(instance *model.ServiceInstance, now time.Time) model.HealthState {
+	switch since := now.Sub(instance.LastActive); {
+	case since <= r.ttl:
+		return model.HealthPassing
+	case since <= r.ttl+r.gracePeriod:
+		return model.HealthWarning
+	default:
+		return model.HealthCritical
+	}
+}
+
+// notify wakes up the watchers. It must be called with the registry locked.
+func (r *Registry) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
 }
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery"
+	"github.com/akkahshh24/movieapp/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewRegistry()
+	require.NoError(t, r.Register(ctx, "rating-1", "rating", "localhost:8082", nil))
+
+	updates, err := r.Watch(ctx, "rating")
+	require.NoError(t, err)
+	next := func() []string {
+		select {
+		case u := <-updates:
+			assert.NoError(t, u.Err)
+			return u.Endpoints
+		case <-time.After(time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+	assert.Equal(t, []string{"localhost:8082"}, next())
+
+	require.NoError(t, r.Register(ctx, "rating-2", "rating", "localhost:8085", nil))
+	assert.Equal(t, []string{"localhost:8082", "localhost:8085"}, next())
+
+	require.NoError(t, r.Deregister(ctx, "rating-1", "rating"))
+	assert.Equal(t, []string{"localhost:8085"}, next())
+
+	// The updates stop once the watch is cancelled.
+	cancel()
+	for range updates {
+	}
+}
+
+func TestReap(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistryWithTTL(time.Second, time.Minute)
+	require.NoError(t, r.Register(ctx, "rating-1", "rating", "localhost:8082", nil))
+	require.NoError(t, r.Register(ctx, "rating-2", "rating", "localhost:8085", nil))
+	registered := time.Now()
+
+	// A missed health report turns an instance to warning, which is not returned as an endpoint.
+	r.serviceAddrs["rating"]["rating-1"].LastActive = registered.Add(-2 * time.Second)
+	r.reap(time.Now())
+	instances, err := r.ServiceInstances(ctx, "rating")
+	require.NoError(t, err)
+	states := map[model.InstanceID]model.HealthState{}
+	for _, instance := range instances {
+		states[instance.InstanceID] = instance.State
+	}
+	assert.Equal(t, map[model.InstanceID]model.HealthState{"rating-1": model.HealthWarning, "rating-2": model.HealthPassing}, states)
+	addrs, err := r.ServiceEndpoints(ctx, "rating")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:8085"}, addrs)
+
+	// A critical instance is removed once the grace period is over.
+	r.reap(registered.Add(2 * time.Minute))
+	_, err = r.ServiceInstances(ctx, "rating")
+	assert.ErrorIs(t, err, discovery.ErrNotFound)
+
+	// A removed instance that reports a healthy state again is back.
+	require.NoError(t, r.ReportHealthyState("rating-2", "rating"))
+	addrs, err = r.ServiceEndpoints(ctx, "rating")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:8085"}, addrs)
+
+	// A deregistered instance cannot come back.
+	require.NoError(t, r.Deregister(ctx, "rating-1", "rating"))
+	assert.Error(t, r.ReportHealthyState("rating-1", "rating"))
+}
+
+func TestServiceEndpointsFiltersByTags(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	require.NoError(t, r.Register(ctx, "rating-1", "rating", "localhost:8082", model.InstanceMetadata{"version": "v1", "zone": "a"}))
+	require.NoError(t, r.Register(ctx, "rating-2", "rating", "localhost:8085", model.InstanceMetadata{"version": "v2", "zone": "a"}))
+
+	addrs, err := r.ServiceEndpoints(ctx, "rating", "version=v2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:8085"}, addrs)
+
+	addrs, err = r.ServiceEndpoints(ctx, "rating", "zone=a")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"localhost:8082", "localhost:8085"}, addrs)
+
+	addrs, err = r.ServiceEndpoints(ctx, "rating", "zone=a", "version=v3")
+	require.NoError(t, err)
+	assert.Empty(t, addrs)
+
+	// A tag is a metadata entry, so a bare key does not match.
+	addrs, err = r.ServiceEndpoints(ctx, "rating", "zone")
+	require.NoError(t, err)
+	assert.Empty(t, addrs)
+}
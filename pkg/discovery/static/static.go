@@ -0,0 +1,120 @@
+package static
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery"
+	"github.com/akkahshh24/movieapp/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+// debounceWindow defines how long the changes of a watched service are collected before they are sent.
+const debounceWindow = 50 * time.Millisecond
+
+// Endpoint defines a service instance known upfront.
+// In YAML, it is either an address, such as localhost:8082, or a mapping with an address and metadata.
+type Endpoint struct {
+	Address  string                 `yaml:"address" json:"address"`
+	Metadata model.InstanceMetadata `yaml:"metadata" json:"metadata"`
+}
+
+// UnmarshalYAML decodes an endpoint from either an address or a mapping.
+func (e *Endpoint) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*e = Endpoint{Address: value.Value}
+		return nil
+	}
+	// endpoint has the fields of Endpoint without its UnmarshalYAML method.
+	type endpoint Endpoint
+	return value.Decode((*endpoint)(e))
+}
+
+// Registry defines a static service registry, whose instances are known upfront and always active.
+// Registering, deregistering and reporting the state of an instance do nothing, so services
+// can run unchanged on top of it.
+type Registry struct {
+	mu       sync.RWMutex
+	services map[model.ServiceName][]Endpoint
+	// changed is closed and replaced whenever the instances are replaced, which wakes up the watchers.
+	changed chan struct{}
+}
+
+// NewRegistry creates a new static service registry instance with the instances of each service.
+func NewRegistry(services map[model.ServiceName][]Endpoint) *Registry {
+	return &Registry{services: maps.Clone(services), changed: make(chan struct{})}
+}
+
+// Set replaces the instances of all services.
+func (r *Registry) Set(services map[model.ServiceName][]Endpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services = maps.Clone(services)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Register does nothing, as the instances are known upfront.
+func (r *Registry) Register(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName, hostPort string, metadata model.InstanceMetadata) error {
+	return nil
+}
+
+// Deregister does nothing, as the instances are known upfront.
+func (r *Registry) Deregister(ctx context.Context, instanceID model.InstanceID, serviceName model.ServiceName) error {
+	return nil
+}
+
+// ReportHealthyState does nothing, as the instances are always active.
+func (r *Registry) ReportHealthyState(instanceID model.InstanceID, serviceName model.ServiceName) error {
+	return nil
+}
+
+// ServiceEndpoints returns the list of addresses of the instances of the given service having all the given tags.
+func (r *Registry) ServiceEndpoints(ctx context.Context, serviceName model.ServiceName, tags ...string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.services[serviceName]) == 0 {
+		return nil, discovery.ErrNotFound
+	}
+	return r.endpoints(serviceName, tags), nil
+}
+
+// Watch streams the addresses of the instances of the given service having all the given tags whenever they change.
+func (r *Registry) Watch(ctx context.Context, serviceName model.ServiceName, tags ...string) (<-chan discovery.Update, error) {
+	updates := make(chan discovery.Update)
+	go func() {
+		defer close(updates)
+		for {
+			r.mu.RLock()
+			addrs := r.endpoints(serviceName, tags)
+			changed := r.changed
+			r.mu.RUnlock()
+
+			select {
+			case updates <- discovery.Update{Endpoints: addrs}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return discovery.Debounce(ctx, updates, debounceWindow), nil
+}
+
+// endpoints returns the addresses of the instances of a service having all the given tags.
+// It must be called with the registry locked.
+func (r *Registry) endpoints(serviceName model.ServiceName, tags []string) []string {
+	var res []string
+	for _, e := range r.services[serviceName] {
+		if e.Metadata.HasTags(tags) {
+			res = append(res, e.Address)
+		}
+	}
+	return res
+}
@@ -0,0 +1,170 @@
+// Package loader protects a backing store from cache misses: concurrent loads of the same key
+// are collapsed into one, and keys found missing are remembered for a short while.
+// Loads that overlap with a write of their key do not fill the cache, as they may have read the value
+// from before the write.
+package loader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/lru"
+	"golang.org/x/sync/singleflight"
+)
+
+// Metrics describes how many loads reached the backing store and how many were avoided.
+type Metrics struct {
+	// Loads is the number of loads that reached the backing store.
+	Loads int64 `json:"loads"`
+	// Collapsed is the number of calls that shared the result of a load already in flight.
+	Collapsed int64 `json:"collapsed"`
+	// NegativeHits is the number of calls answered by a remembered missing key.
+	NegativeHits int64 `json:"negativeHits"`
+}
+
+// Loader defines a loader of values that are missing from a cache.
+type Loader[V any] struct {
+	errNotFound error
+	group       singleflight.Group
+	// missing remembers the keys whose load failed with errNotFound. It is nil if negative caching is disabled.
+	missing *lru.Cache[string, struct{}]
+
+	mu sync.Mutex
+	// flights are the loads in flight, by key.
+	flights map[string]*flight
+	// writes are the numbers of writes in progress, by key.
+	writes map[string]int
+
+	loads, collapsed, negativeHits atomic.Int64
+}
+
+// New creates a loader that remembers for negativeTTL the keys whose load failed with errNotFound,
+// up to maxMissing keys. Missing keys are not remembered if negativeTTL is 0.
+func New[V any](errNotFound error, negativeTTL time.Duration, maxMissing int) *Loader[V] {
+	l := &Loader[V]{errNotFound: errNotFound, flights: map[string]*flight{}, writes: map[string]int{}}
+	if negativeTTL > 0 {
+		l.missing = lru.New[string, struct{}](maxMissing, negativeTTL)
+	}
+	return l
+}
+
+// flight defines a load in flight.
+type flight struct {
+	mu sync.Mutex
+	// stale is set if the key has been written since the load started, in which case its result may be outdated.
+	stale bool
+}
+
+// markStale marks a load as outdated. It waits for the load to fill the cache if it is doing so.
+func (f *flight) markStale() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stale = true
+}
+
+// Load returns the value of a key loaded by fn, sharing the result with the concurrent calls for the same key,
+// and passes the loaded value to fill, if set, typically to store it in a cache.
+// It returns errNotFound without calling fn if the key was recently found missing.
+// A load that overlaps with a write of its key, see Write, neither calls fill nor remembers the key as missing.
+// fn and fill are not cancelled when ctx is, as other calls may be waiting for the result.
+func (l *Loader[V]) Load(ctx context.Context, key string, fn func(ctx context.Context) (V, error), fill func(ctx context.Context, v V)) (V, error) {
+	var zero V
+	if l.missing != nil {
+		if _, ok := l.missing.Get(key); ok {
+			l.negativeHits.Add(1)
+			return zero, l.errNotFound
+		}
+	}
+
+	var leader bool
+	ch := l.group.DoChan(key, func() (any, error) {
+		leader = true
+		l.loads.Add(1)
+		f := l.startFlight(key)
+		defer l.endFlight(key)
+
+		ctx := context.WithoutCancel(ctx)
+		v, err := fn(ctx)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.stale {
+			return v, err
+		}
+		if err == nil && fill != nil {
+			fill(ctx, v)
+		}
+		if l.missing != nil && errors.Is(err, l.errNotFound) {
+			l.missing.Put(key, struct{}{})
+		}
+		return v, err
+	})
+
+	select {
+	case res := <-ch:
+		if res.Shared && !leader {
+			l.collapsed.Add(1)
+		}
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(V), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Write marks a key as being written until the returned function is called, and drops it from the remembered
+// missing keys. It must be called before the value is written to the backing store, and the returned function
+// once the write and the cache update are done, so that the loads in between do not fill the cache with the
+// value from before the write.
+func (l *Loader[V]) Write(key string) (done func()) {
+	l.mu.Lock()
+	l.writes[key]++
+	f := l.flights[key]
+	l.mu.Unlock()
+
+	if l.missing != nil {
+		l.missing.Delete(key)
+	}
+	if f != nil {
+		f.markStale()
+	}
+
+	return func() {
+		l.mu.Lock()
+		if l.writes[key]--; l.writes[key] == 0 {
+			delete(l.writes, key)
+		}
+		f := l.flights[key]
+		l.mu.Unlock()
+
+		// A load that started during the write may have read the value from before it.
+		if f != nil {
+			f.markStale()
+		}
+	}
+}
+
+// startFlight registers a load of a key, which is stale from the start if the key is being written.
+func (l *Loader[V]) startFlight(key string) *flight {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f := &flight{stale: l.writes[key] > 0}
+	l.flights[key] = f
+	return f
+}
+
+// endFlight unregisters the load of a key.
+func (l *Loader[V]) endFlight(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.flights, key)
+}
+
+// Metrics returns a snapshot of the loader metrics.
+func (l *Loader[V]) Metrics() Metrics {
+	return Metrics{Loads: l.loads.Load(), Collapsed: l.collapsed.Load(), NegativeHits: l.negativeHits.Load()}
+}
@@ -0,0 +1,103 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotFound = errors.New("not found")
+
+func TestLoadCollapsesConcurrentCalls(t *testing.T) {
+	l := New[int](errNotFound, 0, 0)
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := l.Load(context.Background(), "key", fn, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, 42, v)
+		}()
+	}
+	// Let the calls join the load in flight before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, Metrics{Loads: 1, Collapsed: 4}, l.Metrics())
+}
+
+func TestLoadRemembersMissingKeys(t *testing.T) {
+	l := New[int](errNotFound, time.Minute, 10)
+	var loads int
+	fn := func(context.Context) (int, error) {
+		loads++
+		return 0, errNotFound
+	}
+
+	for range 2 {
+		_, err := l.Load(context.Background(), "key", fn, nil)
+		assert.ErrorIs(t, err, errNotFound)
+	}
+	assert.Equal(t, 1, loads)
+
+	l.Write("key")()
+	_, err := l.Load(context.Background(), "key", fn, nil)
+	assert.ErrorIs(t, err, errNotFound)
+	assert.Equal(t, 2, loads)
+	assert.Equal(t, Metrics{Loads: 2, NegativeHits: 1}, l.Metrics())
+}
+
+func TestLoadOverlappingWriteDoesNotFill(t *testing.T) {
+	l := New[int](errNotFound, time.Minute, 10)
+	var filled []int
+	fill := func(_ context.Context, v int) {
+		filled = append(filled, v)
+	}
+
+	// A load reads the value, then the key is written before the load completes.
+	read := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := l.Load(context.Background(), "key", func(context.Context) (int, error) {
+			close(read)
+			<-release
+			return 0, errNotFound
+		}, fill)
+		assert.ErrorIs(t, err, errNotFound)
+	}()
+	<-read
+	l.Write("key")()
+	close(release)
+	<-done
+
+	// The outdated result is neither remembered as missing nor stored.
+	v, err := l.Load(context.Background(), "key", func(context.Context) (int, error) {
+		return 42, nil
+	}, fill)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	assert.Equal(t, []int{42}, filled)
+
+	// A load that starts during a write does not fill the cache either.
+	writeDone := l.Write("key")
+	_, err = l.Load(context.Background(), "key", func(context.Context) (int, error) {
+		return 43, nil
+	}, fill)
+	assert.NoError(t, err)
+	writeDone()
+	assert.Equal(t, []int{42}, filled)
+}
@@ -0,0 +1,145 @@
+// Package lru provides a concurrency-safe cache that holds a bounded number of entries,
+// evicting the least recently used one when it is full, and expires entries after a TTL.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats describes the usage of a cache.
+type Stats struct {
+	// Entries is the number of entries currently held, including expired ones not removed yet.
+	Entries int `json:"entries"`
+	// Hits is the number of lookups that found an entry.
+	Hits int64 `json:"hits"`
+	// Misses is the number of lookups that found no entry or an expired one.
+	Misses int64 `json:"misses"`
+	// Evictions is the number of entries removed to make room for new ones.
+	Evictions int64 `json:"evictions"`
+	// Expirations is the number of entries removed because they outlived the TTL.
+	Expirations int64 `json:"expirations"`
+}
+
+// Cache defines an LRU cache with expiring entries.
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	order      *list.List // Most recently used first.
+	items      map[K]*list.Element
+	stats      Stats
+	now        func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a cache holding at most maxEntries entries for ttl each.
+// The number of entries is unbounded if maxEntries is 0, and entries never expire if ttl is 0.
+func New[K comparable, V any](maxEntries int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		order:      list.New(),
+		items:      map[K]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+// Get returns the value of a key and marks it as recently used. It reports whether the key was found.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.lookup(key)
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.stats.Hits++
+	return e.value, true
+}
+
+// Put sets the value of a key, restarting its TTL, and evicts the least recently used entry if the cache is full.
+func (c *Cache[K, V]) Put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = c.now().Add(c.ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expiresAt = value, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Update replaces the value of a key with the result of fn, which is called with the cache locked.
+// It reports whether the key was found. The TTL of the entry is left unchanged.
+func (c *Cache[K, V]) Update(key K, fn func(V) V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+	e.value = fn(e.value)
+	return true
+}
+
+// Delete removes a key from the cache.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Stats returns the usage of the cache.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Entries = c.order.Len()
+	return s
+}
+
+// lookup returns the live entry of a key and marks it as recently used. An expired entry is removed.
+func (c *Cache[K, V]) lookup(key K) (*entry[K, V], bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		c.stats.Expirations++
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
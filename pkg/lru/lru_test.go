@@ -0,0 +1,46 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2, 0)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	// Reading a makes b the least recently used entry.
+	_, _ = c.Get("a")
+	c.Put("c", 3)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	assert.True(t, c.Update("c", func(v int) int { return v + 1 }))
+	assert.False(t, c.Update("b", func(v int) int { return v + 1 }))
+	v, _ = c.Get("c")
+	assert.Equal(t, 4, v)
+
+	assert.Equal(t, Stats{Entries: 2, Hits: 3, Misses: 1, Evictions: 1}, c.Stats())
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	now := time.Now()
+	c := New[string, int](0, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Put("a", 1)
+
+	now = now.Add(59 * time.Second)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, Stats{Entries: 0, Hits: 1, Misses: 1, Expirations: 1}, c.Stats())
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
 
 // ServiceName defines a service name.
 type ServiceName string
@@ -16,10 +20,60 @@ func (i InstanceID) String() string {
 	return string(i)
 }
 
+// Well-known keys of the instance metadata.
+const (
+	MetadataVersion = "version"
+	MetadataZone    = "zone"
+)
+
+// InstanceMetadata defines the metadata of a service instance, such as its version or zone.
+// Each entry is also a tag of the instance, in the form key=value, for example version=v2.
+type InstanceMetadata map[string]string
+
+// Tags returns the tags of the instance, sorted.
+func (m InstanceMetadata) Tags() []string {
+	var res []string
+	for k, v := range m {
+		res = append(res, k+"="+v)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// HasTags checks whether the instance has all the given tags.
+// The instance has no tag other than its metadata entries, so, as in Consul, a tag not in the form key=value never matches.
+func (m InstanceMetadata) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			return false
+		}
+		if got, ok := m[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthState defines the health of a service instance.
+type HealthState string
+
+// Health states of a service instance.
+const (
+	// HealthPassing is the state of an instance that has reported a healthy state recently.
+	HealthPassing = HealthState("passing")
+	// HealthWarning is the state of an instance that has missed its health reports but may still recover.
+	HealthWarning = HealthState("warning")
+	// HealthCritical is the state of an instance that is considered dead.
+	HealthCritical = HealthState("critical")
+)
+
 // ServiceInstance defines a service instance with its metadata.
 type ServiceInstance struct {
 	ServiceName ServiceName
 	InstanceID  InstanceID
 	HostPort    string
+	Metadata    InstanceMetadata
 	LastActive  time.Time
+	State       HealthState
 }
@@ -0,0 +1,161 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrNil is returned when a requested key does not exist.
+var ErrNil = errors.New("resp: nil")
+
+// Client defines a RESP client keeping a pool of connections to a server.
+// It is safe for concurrent use.
+type Client struct {
+	addr    string
+	timeout time.Duration
+	conns   chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewClient creates a client of the server at addr that keeps up to poolSize idle connections
+// and gives up on a command after timeout. Commands have no timeout other than their context's if timeout is 0.
+func NewClient(addr string, poolSize int, timeout time.Duration) *Client {
+	return &Client{addr: addr, timeout: timeout, conns: make(chan *conn, max(poolSize, 1))}
+}
+
+// Do sends a command and returns its reply, see readValue. An error reply is returned as an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if c.timeout > 0 && (!ok || time.Until(deadline) > c.timeout) {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if err := cn.SetDeadline(deadline); err != nil {
+		cn.Close()
+		return nil, err
+	}
+
+	cmd := make([]any, len(args))
+	for i, arg := range args {
+		cmd[i] = []byte(arg)
+	}
+	if err := writeValue(cn.w, cmd); err != nil {
+		cn.Close()
+		return nil, err
+	}
+	if err := cn.w.Flush(); err != nil {
+		cn.Close()
+		return nil, err
+	}
+	reply, err := readValue(cn.r)
+	if err != nil {
+		// The connection is in an unknown state, so it cannot be reused.
+		cn.Close()
+		return nil, err
+	}
+	c.release(cn)
+
+	if err, ok := reply.(Error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Ping checks that the server is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of a key or ErrNil if it does not exist.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("resp: unexpected reply to GET: %T", reply)
+	}
+	return value, nil
+}
+
+// Set sets the value of a key that expires after ttl, or never if ttl is 0.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys and returns how many of them existed.
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	reply, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("resp: unexpected reply to DEL: %T", reply)
+	}
+	return n, nil
+}
+
+// Close closes the idle connections of the client.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.conns:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// conn returns an idle connection or dials a new one.
+func (c *Client) conn(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.conns:
+		return cn, nil
+	default:
+	}
+
+	var d net.Dialer
+	if c.timeout > 0 {
+		d.Timeout = c.timeout
+	}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
+
+// release returns a connection to the pool or closes it if the pool is full.
+func (c *Client) release(cn *conn) {
+	select {
+	case c.conns <- cn:
+	default:
+		cn.Close()
+	}
+}
@@ -0,0 +1,119 @@
+// Package resp implements a client and an embedded server for the Redis serialization protocol (RESP),
+// which is enough to use Redis or a compatible server as a cache shared by the replicas of a service.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error is an error reply of the server, for example: ERR unknown command.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// maxBulkLen is the largest bulk string accepted, the same limit as Redis.
+const maxBulkLen = 512 << 20
+
+var errProtocol = errors.New("resp: protocol error")
+
+// readValue reads a single value: a string for a simple string, an Error, an int64 for an integer,
+// a []byte for a bulk string, an []any for an array, or nil for a null bulk string or array.
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return string(line), nil
+	case '-':
+		return Error(line), nil
+	case ':':
+		n, err := strconv.ParseInt(string(line), 10, 64)
+		if err != nil {
+			return nil, errProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(string(line))
+		if err != nil || n > maxBulkLen {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line))
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, errProtocol
+	}
+}
+
+// writeValue writes a value of one of the types returned by readValue. Strings other than
+// simple strings must be given as []byte, and a nil []byte is written as a null bulk string.
+func writeValue(w *bufio.Writer, v any) error {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		_, err = w.WriteString("$-1\r\n")
+	case string:
+		_, err = fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		_, err = fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		_, err = fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		if v == nil {
+			_, err = w.WriteString("$-1\r\n")
+			break
+		}
+		if _, err = fmt.Fprintf(w, "$%d\r\n", len(v)); err != nil {
+			return err
+		}
+		if _, err = w.Write(v); err != nil {
+			return err
+		}
+		_, err = w.WriteString("\r\n")
+	case []any:
+		if _, err = fmt.Fprintf(w, "*%d\r\n", len(v)); err != nil {
+			return err
+		}
+		for _, e := range v {
+			if err := writeValue(w, e); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("resp: cannot write %T", v)
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package resp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	srv, err := NewServer("localhost:0")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := NewClient(srv.Addr(), 2, time.Second)
+	defer c.Close()
+
+	assert.NoError(t, c.Ping(ctx))
+
+	_, err = c.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNil)
+
+	// Values are binary-safe.
+	value := []byte("line\r\nbreak")
+	assert.NoError(t, c.Set(ctx, "key", value, 0))
+	got, err := c.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, value, got)
+
+	assert.NoError(t, c.Set(ctx, "expiring", []byte("1"), 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, err = c.Get(ctx, "expiring")
+	assert.ErrorIs(t, err, ErrNil)
+
+	n, err := c.Del(ctx, "key", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = c.Do(ctx, "UNKNOWN")
+	var respErr Error
+	assert.ErrorAs(t, err, &respErr)
+	// The connection is still usable after an error reply.
+	assert.NoError(t, c.Ping(ctx))
+}
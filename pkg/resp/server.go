@@ -0,0 +1,182 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server defines an in-process RESP server supporting the commands used by Client:
+// PING, GET, SET with EX or PX, DEL and FLUSHALL. It is meant for tests and local runs.
+type Server struct {
+	lis net.Listener
+
+	mu   sync.Mutex
+	data map[string]serverEntry
+
+	wg    sync.WaitGroup
+	conns map[net.Conn]struct{}
+}
+
+type serverEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewServer starts a server listening on addr, for example: localhost:0 for a random port.
+func NewServer(addr string) (*Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{lis: lis, data: map[string]serverEntry{}, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() error {
+	err := s.lis.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(c)
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// handle replies to the commands of a connection until it is closed.
+func (s *Server) handle(c net.Conn) {
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	for {
+		cmd, err := readValue(r)
+		if err != nil {
+			return
+		}
+		if err := writeValue(w, s.exec(cmd)); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec executes a command given as an array of bulk strings and returns its reply.
+func (s *Server) exec(cmd any) any {
+	values, ok := cmd.([]any)
+	if !ok || len(values) == 0 {
+		return Error("ERR invalid command")
+	}
+	args := make([]string, len(values))
+	for i, v := range values {
+		b, ok := v.([]byte)
+		if !ok {
+			return Error("ERR invalid command")
+		}
+		args[i] = string(b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch name := strings.ToUpper(args[0]); {
+	case name == "PING":
+		return "PONG"
+	case name == "GET" && len(args) == 2:
+		e, ok := s.lookup(args[1])
+		if !ok {
+			return nil
+		}
+		return e.value
+	case name == "SET" && len(args) >= 3:
+		e := serverEntry{value: []byte(args[2])}
+		if len(args) > 3 {
+			ttl, err := parseTTL(args[3:])
+			if err != nil {
+				return Error("ERR " + err.Error())
+			}
+			e.expiresAt = time.Now().Add(ttl)
+		}
+		s.data[args[1]] = e
+		return "OK"
+	case name == "DEL" && len(args) >= 2:
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(key); ok {
+				delete(s.data, key)
+				n++
+			}
+		}
+		return n
+	case name == "FLUSHALL":
+		clear(s.data)
+		return "OK"
+	default:
+		return Error("ERR unknown command or wrong number of arguments for '" + args[0] + "'")
+	}
+}
+
+// lookup returns the entry of a key unless it does not exist or has expired.
+func (s *Server) lookup(key string) (serverEntry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(s.data, key)
+		return serverEntry{}, false
+	}
+	return e, ok
+}
+
+// parseTTL parses the EX seconds or PX milliseconds option of SET.
+func parseTTL(args []string) (time.Duration, error) {
+	if len(args) != 2 {
+		return 0, errors.New("syntax error")
+	}
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid expire time in 'set' command")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "EX":
+		return time.Duration(n) * time.Second, nil
+	case "PX":
+		return time.Duration(n) * time.Millisecond, nil
+	default:
+		return 0, errors.New("syntax error")
+	}
+}
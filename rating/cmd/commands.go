@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/internal/ingester/kafka"
+	"github.com/akkahshh24/movieapp/rating/internal/repository/mysql"
+)
+
+// commands defines maintenance commands that can be run instead of the service,
+// for example: ./main repair-aggregates
+var commands = map[string]func(ctx context.Context, cfg config) error{
+	"repair-aggregates": repairAggregates,
+	"replay-dlq":        replayDeadLetters,
+}
+
+// repairAggregates rebuilds the running rating aggregates from the individual ratings.
+func repairAggregates(ctx context.Context, cfg config) error {
+	if cfg.Database.Type != "" && cfg.Database.Type != "mysql" {
+		return fmt.Errorf("aggregates are only stored in a mysql database, not %q", cfg.Database.Type)
+	}
+	repo, err := mysql.New(cfg.Database.dsn())
+	if err != nil {
+		return err
+	}
+
+	log.Println("Rebuilding rating aggregates")
+	if err := repo.RebuildAggregates(ctx); err != nil {
+		return err
+	}
+	log.Println("Rating aggregates rebuilt")
+	return nil
+}
+
+// replayDeadLetters moves the rating events of the dead-letter topic back to the main topic,
+// for example after the cause of their failure has been fixed.
+func replayDeadLetters(ctx context.Context, cfg config) error {
+	mq := cfg.MessageQueue
+	if mq.DeadLetterTopic == "" {
+		return errors.New("no dead-letter topic configured")
+	}
+
+	log.Printf("Replaying rating events from %s to %s", mq.DeadLetterTopic, mq.Topic)
+	n, err := kafka.ReplayDeadLetters(ctx, mq.Address, mq.GroupID+"-replay", mq.DeadLetterTopic, mq.Topic, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	log.Printf("Replayed %d rating events", n)
+	return nil
+}
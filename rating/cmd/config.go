@@ -1,19 +1,48 @@
 package main
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
+)
+
 type config struct {
-	API              apiConfig              `yaml:"api"`
-	ServiceDiscovery serviceDiscoveryConfig `yaml:"serviceDiscovery"`
-	MessageQueue     messageQueueConfig     `yaml:"messageQueue"`
-	Database         databaseConfig         `yaml:"database"`
+	API              apiConfig                 `yaml:"api"`
+	ServiceDiscovery serviceDiscoveryConfig    `yaml:"serviceDiscovery"`
+	MessageQueue     messageQueueConfig        `yaml:"messageQueue"`
+	Database         databaseConfig            `yaml:"database"`
+	Aggregation      aggregationConfig         `yaml:"aggregation"`
+	RecordTypes      map[string]scaleConfig    `yaml:"recordTypes"`
+	Providers        map[string]providerConfig `yaml:"providers"`
+	Outbox           outboxConfig              `yaml:"outbox"`
+	Cache            cacheConfig               `yaml:"cache"`
 }
 
 type apiConfig struct {
 	Port int `yaml:"port"`
+	// MetricsPort is the port of the HTTP server exposing metrics on /debug/vars. It is disabled if 0.
+	MetricsPort int `yaml:"metricsPort"`
 }
 
 type serviceDiscoveryConfig struct {
-	Name   string       `yaml:"name"`
-	Consul consulConfig `yaml:"consul"`
+	// Type is the service registry: consul, static, with the instances listed in the config, or file,
+	// with the instances listed in a file that is reloaded when it changes.
+	Type string `yaml:"type"`
+	Name string `yaml:"name"`
+	// Metadata is registered along with the service instance, for example its version and zone.
+	// Each entry is also a tag of the instance, in the form key=value.
+	Metadata map[string]string `yaml:"metadata"`
+	Consul   consulConfig      `yaml:"consul"`
+	// Static maps each service to its instances, given as addresses or as mappings with an address and metadata.
+	Static map[string][]static.Endpoint `yaml:"static"`
+	File   registryFileConfig           `yaml:"file"`
+}
+
+// registryFileConfig defines a YAML or JSON file mapping each service to its instances, like the static config.
+type registryFileConfig struct {
+	Path         string        `yaml:"path"`
+	PollInterval time.Duration `yaml:"pollInterval"`
 }
 
 type consulConfig struct {
@@ -21,15 +50,115 @@ type consulConfig struct {
 }
 
 type messageQueueConfig struct {
-	Address string `yaml:"address"`
-	GroupID string `yaml:"groupID"`
-	Topic   string `yaml:"topic"`
+	// Type is the message queue the rating events are ingested from: kafka, memory or file.
+	Type            string        `yaml:"type"`
+	File            fileConfig    `yaml:"file"`
+	Address         string        `yaml:"address"`
+	GroupID         string        `yaml:"groupID"`
+	Topic           string        `yaml:"topic"`
+	DeadLetterTopic string        `yaml:"deadLetterTopic"`
+	Workers         int           `yaml:"workers"`
+	BatchSize       int           `yaml:"batchSize"`
+	FlushInterval   time.Duration `yaml:"flushInterval"`
+	Retry           retryConfig   `yaml:"retry"`
+	// ProcessedRetention is how long the keys of processed events are kept to skip redeliveries.
+	// It must exceed the retention of the topic. The keys are kept forever if it is 0 or the queue is not Kafka.
+	ProcessedRetention time.Duration `yaml:"processedRetention"`
+}
+
+// fileConfig defines a file of JSON-encoded rating events, one per line, that is followed like tail -f.
+type fileConfig struct {
+	Path           string        `yaml:"path"`
+	PollInterval   time.Duration `yaml:"pollInterval"`
+	DeadLetterPath string        `yaml:"deadLetterPath"`
+}
+
+type retryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// outboxConfig defines how rating changes made through the API are published to the message queue.
+type outboxConfig struct {
+	// Topic is the topic the rating events are published to. The relay is disabled if it is empty.
+	Topic string `yaml:"topic"`
+	// Format is the encoding of the published events: json or proto.
+	Format    string        `yaml:"format"`
+	Interval  time.Duration `yaml:"interval"`
+	BatchSize int           `yaml:"batchSize"`
 }
 
 type databaseConfig struct {
+	// Type is the repository of the ratings: mysql, or memory, which loses the ratings when the service stops.
+	Type     string `yaml:"type"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 }
+
+type aggregationConfig struct {
+	DefaultStrategy string            `yaml:"defaultStrategy"`
+	RecordTypes     map[string]string `yaml:"recordTypes"`
+	Bayesian        bayesianConfig    `yaml:"bayesian"`
+	TrimmedMean     trimmedMeanConfig `yaml:"trimmedMean"`
+	TimeDecay       timeDecayConfig   `yaml:"timeDecay"`
+}
+
+type bayesianConfig struct {
+	PriorWeight float64 `yaml:"priorWeight"`
+}
+
+type trimmedMeanConfig struct {
+	TrimRatio float64 `yaml:"trimRatio"`
+}
+
+type timeDecayConfig struct {
+	HalfLife time.Duration `yaml:"halfLife"`
+}
+
+type scaleConfig struct {
+	Min  int `yaml:"min"`
+	Max  int `yaml:"max"`
+	Step int `yaml:"step"`
+}
+
+// providerConfig defines how the ratings ingested from a provider are accepted.
+// Events of all providers are ingested if no provider is configured.
+type providerConfig struct {
+	// RecordTypes lists the record types the provider may rate. All record types are allowed if it is empty.
+	RecordTypes []string `yaml:"recordTypes"`
+	// Scale is the rating scale of the provider. The scale of the record type is used if it is not set.
+	Scale *scaleConfig `yaml:"scale"`
+	// Weight is the trust in the ratings of the provider. It defaults to 1.
+	Weight *float64 `yaml:"weight"`
+}
+
+// cacheConfig defines the cache of aggregated ratings.
+type cacheConfig struct {
+	// Type is the cache backend: memory, private to each replica, or redis, shared by all replicas.
+	Type string `yaml:"type"`
+	// MaxEntries is the number of records cached at most in memory. It is unbounded if 0.
+	MaxEntries int `yaml:"maxEntries"`
+	// TTL is how long an aggregated rating is cached. It never expires if 0.
+	TTL time.Duration `yaml:"ttl"`
+	// NegativeTTL is how long records that are not found are remembered as missing. They are not remembered if 0.
+	NegativeTTL time.Duration `yaml:"negativeTTL"`
+	Redis       redisConfig   `yaml:"redis"`
+}
+
+// redisConfig defines a Redis or compatible server.
+type redisConfig struct {
+	Address string `yaml:"address"`
+	// Namespace prefixes the keys of the service, so that services can share a server.
+	Namespace string        `yaml:"namespace"`
+	PoolSize  int           `yaml:"poolSize"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// dsn returns the MySQL DSN in the form: user:password@tcp(host:port)/dbname?parseTime=true
+func (c databaseConfig) dsn() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", c.User, c.Password, c.Host, c.Port, c.DBName)
+}
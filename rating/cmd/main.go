@@ -2,21 +2,35 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/akkahshh24/movieapp/gen"
 	"github.com/akkahshh24/movieapp/pkg/discovery"
 	"github.com/akkahshh24/movieapp/pkg/discovery/consul"
+	"github.com/akkahshh24/movieapp/pkg/discovery/file"
+	"github.com/akkahshh24/movieapp/pkg/discovery/static"
 	"github.com/akkahshh24/movieapp/pkg/model"
+	"github.com/akkahshh24/movieapp/pkg/resp"
 	"github.com/akkahshh24/movieapp/rating/internal/cache/memory"
+	"github.com/akkahshh24/movieapp/rating/internal/cache/redis"
 	"github.com/akkahshh24/movieapp/rating/internal/controller/rating"
 	grpchandler "github.com/akkahshh24/movieapp/rating/internal/handler/grpc"
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
+	fileingester "github.com/akkahshh24/movieapp/rating/internal/ingester/file"
 	"github.com/akkahshh24/movieapp/rating/internal/ingester/kafka"
+	memoryingester "github.com/akkahshh24/movieapp/rating/internal/ingester/memory"
+	"github.com/akkahshh24/movieapp/rating/internal/outbox"
+	outboxkafka "github.com/akkahshh24/movieapp/rating/internal/outbox/kafka"
+	"github.com/akkahshh24/movieapp/rating/internal/repository"
+	memoryrepository "github.com/akkahshh24/movieapp/rating/internal/repository/memory"
 	"github.com/akkahshh24/movieapp/rating/internal/repository/mysql"
+	ratingmodel "github.com/akkahshh24/movieapp/rating/pkg/model"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"gopkg.in/yaml.v3"
@@ -33,21 +47,31 @@ func main() {
 		panic(err)
 	}
 
+	// Run a maintenance command instead of the service if one is requested.
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(context.Background(), cfg); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	port := cfg.API.Port
 	log.Printf("Starting the rating service on port %d", port)
 
-	// Create a new Consul registry
-	// This will be used for service discovery.
-	registry, err := consul.NewRegistry(cfg.ServiceDiscovery.Consul.Address)
+	// Create the service registry, Consul by default.
+	// It is used both to register this service and to discover the other services.
+	ctx := context.Background()
+	registry, err := newRegistry(ctx, cfg.ServiceDiscovery)
 	if err != nil {
 		panic(err)
 	}
 
 	// Register the rating service.
-	ctx := context.Background()
 	serviceName := model.ServiceName(cfg.ServiceDiscovery.Name)
 	instanceID := discovery.GenerateInstanceID(serviceName)
-	if err := registry.Register(ctx, instanceID, serviceName, fmt.Sprintf("%s:%d", serviceName, port)); err != nil {
+	if err := registry.Register(ctx, instanceID, serviceName, fmt.Sprintf("%s:%d", serviceName, port), cfg.ServiceDiscovery.Metadata); err != nil {
 		panic(err)
 	}
 
@@ -63,26 +87,68 @@ func main() {
 	// Deregister the service on exit.
 	defer registry.Deregister(ctx, instanceID, serviceName)
 
-	// Create and in-memory or mysql repository.
-	// Here we are using MySQL as the repository.
-	// You can switch to an in-memory repository for testing purposes.
-	// Construct DSN in the form: user:password@tcp(host:port)/dbname
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName,
-	)
-
-	repo, err := mysql.New(dsn)
+	repo, err := newRepository(cfg.Database)
 	if err != nil {
-		panic(err)
+		log.Fatalf("failed to initialize repository: %v", err)
+	}
+	cache, cacheStats, err := newCache(cfg.Cache)
+	if err != nil {
+		log.Fatalf("failed to initialize cache: %v", err)
 	}
-	cache := memory.New()
 
-	ingester, err := kafka.NewIngester(cfg.MessageQueue.Address, cfg.MessageQueue.GroupID, cfg.MessageQueue.Topic)
+	ingester, publisher, err := newMessageQueue(cfg)
 	if err != nil {
-		log.Fatalf("failed to initialize ingester: %v", err)
+		log.Fatalf("failed to initialize message queue: %v", err)
+	}
+
+	aggregation := newAggregation(cfg.Aggregation)
+	if err := aggregation.Validate(); err != nil {
+		log.Fatalf("invalid aggregation config: %v", err)
+	}
+
+	recordTypes := rating.RecordTypeRegistry{}
+	for recordType, scale := range cfg.RecordTypes {
+		recordTypes[ratingmodel.RecordType(recordType)] = rating.Scale{
+			Min:  ratingmodel.RatingValue(scale.Min),
+			Max:  ratingmodel.RatingValue(scale.Max),
+			Step: ratingmodel.RatingValue(scale.Step),
+		}
+	}
+	if err := recordTypes.Validate(); err != nil {
+		log.Fatalf("invalid record types config: %v", err)
 	}
 
-	ctrl := rating.New(repo, cache, ingester)
+	providers := newProviders(cfg.Providers)
+	if err := providers.Validate(); err != nil {
+		log.Fatalf("invalid providers config: %v", err)
+	}
+
+	ingestion := rating.IngestionConfig{
+		Workers:       cfg.MessageQueue.Workers,
+		BatchSize:     cfg.MessageQueue.BatchSize,
+		FlushInterval: cfg.MessageQueue.FlushInterval,
+		Retry: rating.RetryPolicy{
+			MaxAttempts:    cfg.MessageQueue.Retry.MaxAttempts,
+			InitialBackoff: cfg.MessageQueue.Retry.InitialBackoff,
+			MaxBackoff:     cfg.MessageQueue.Retry.MaxBackoff,
+		},
+		Providers:          providers,
+		ProcessedRetention: processedRetention(cfg.MessageQueue),
+	}
+
+	ctrl := rating.New(repo, cache, ingester, aggregation, recordTypes, ingestion, cfg.Cache.NegativeTTL)
+
+	// Expose the ingestion metrics, for example: curl localhost:9082/debug/vars
+	expvar.Publish("ingestion", expvar.Func(func() any { return ctrl.IngestionMetrics() }))
+	expvar.Publish("cache", expvar.Func(cacheStats))
+	expvar.Publish("loader", expvar.Func(func() any { return ctrl.LoaderMetrics() }))
+	if cfg.API.MetricsPort != 0 {
+		go func() {
+			if err := http.ListenAndServe(fmt.Sprintf("localhost:%d", cfg.API.MetricsPort), nil); err != nil {
+				log.Printf("Failed to serve metrics: %v", err)
+			}
+		}()
+	}
 
 	// Start the consumer to ingest rating events.
 	// This will listen to the Kafka topic and process incoming rating events.
@@ -92,6 +158,12 @@ func main() {
 		}
 	}()
 
+	// Publish the rating changes made through the API.
+	if publisher != nil {
+		relay := outbox.NewRelay(repo, publisher, cfg.ServiceDiscovery.Name, cfg.Outbox.Interval, cfg.Outbox.BatchSize)
+		go relay.Start(ctx)
+	}
+
 	// Create the gRPC handler and register it with the gRPC server.
 	// This handler will implement the gRPC service methods.
 	h := grpchandler.New(ctrl)
@@ -107,3 +179,174 @@ func main() {
 		panic(err)
 	}
 }
+
+// newProviders creates the registry of the providers whose rating events are ingested from the config.
+func newProviders(cfg map[string]providerConfig) rating.ProviderRegistry {
+	providers := rating.ProviderRegistry{}
+	for providerID, c := range cfg {
+		p := rating.Provider{Weight: 1}
+		for _, recordType := range c.RecordTypes {
+			p.RecordTypes = append(p.RecordTypes, ratingmodel.RecordType(recordType))
+		}
+		if c.Scale != nil {
+			p.Scale = &rating.Scale{
+				Min:  ratingmodel.RatingValue(c.Scale.Min),
+				Max:  ratingmodel.RatingValue(c.Scale.Max),
+				Step: ratingmodel.RatingValue(c.Scale.Step),
+			}
+		}
+		if c.Weight != nil {
+			p.Weight = *c.Weight
+		}
+		providers[providerID] = p
+	}
+	return providers
+}
+
+// newAggregation creates the rating aggregation strategies from the config.
+func newAggregation(cfg aggregationConfig) rating.Aggregation {
+	recordTypes := map[ratingmodel.RecordType]string{}
+	for recordType, strategy := range cfg.RecordTypes {
+		recordTypes[ratingmodel.RecordType(recordType)] = strategy
+	}
+	return rating.Aggregation{
+		Strategies: map[string]rating.Strategy{
+			rating.StrategyMean:        rating.MeanStrategy{},
+			rating.StrategyBayesian:    rating.BayesianStrategy{PriorWeight: cfg.Bayesian.PriorWeight},
+			rating.StrategyTrimmedMean: rating.TrimmedMeanStrategy{TrimRatio: cfg.TrimmedMean.TrimRatio},
+			rating.StrategyTimeDecay:   rating.TimeDecayStrategy{HalfLife: cfg.TimeDecay.HalfLife},
+		},
+		RecordTypeStrategies: recordTypes,
+		DefaultStrategy:      cfg.DefaultStrategy,
+	}
+}
+
+type ratingRepository interface {
+	Get(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType) ([]ratingmodel.Rating, error)
+	GetAggregate(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType) (*ratingmodel.AggregatedRating, error)
+	GetTypeAggregate(ctx context.Context, recordType ratingmodel.RecordType) (*ratingmodel.AggregatedRating, error)
+	ListHistory(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType, query repository.HistoryQuery) ([]ratingmodel.Rating, error)
+	ListByUser(ctx context.Context, userID ratingmodel.UserID, query repository.UserRatingsQuery) ([]ratingmodel.Rating, error)
+	Put(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType, rating *ratingmodel.Rating, event *ratingmodel.RatingEvent, processedKey string) (*ratingmodel.Rating, error)
+	Delete(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType, userID ratingmodel.UserID, providerID string, event *ratingmodel.RatingEvent, processedKey string) (*ratingmodel.Rating, error)
+	PutBatch(ctx context.Context, ratings []ratingmodel.Rating, processedKeys []string) error
+	DeleteByProvider(ctx context.Context, providerID string, newEvent func(ratingmodel.Rating) *ratingmodel.RatingEvent) ([]ratingmodel.Rating, error)
+	ProcessedEvents(ctx context.Context, keys []string) (map[string]bool, error)
+	MarkEventsProcessed(ctx context.Context, keys []string) error
+	PruneProcessedEvents(ctx context.Context, before time.Time) (int64, error)
+	ListOutbox(ctx context.Context, limit int) ([]repository.OutboxEntry, error)
+	DeleteOutbox(ctx context.Context, ids []int64) error
+}
+
+// newRepository creates the repository of the ratings, which also holds the outbox, from the config.
+func newRepository(cfg databaseConfig) (ratingRepository, error) {
+	switch cfg.Type {
+	case "", "mysql":
+		return mysql.New(cfg.dsn())
+	case "memory":
+		return memoryrepository.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown database type %q", cfg.Type)
+	}
+}
+
+type aggregateCache interface {
+	Get(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType) (*ratingmodel.AggregatedRating, error)
+	Put(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType, rating *ratingmodel.AggregatedRating) error
+	Update(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType, fn func(*ratingmodel.AggregatedRating)) error
+	Delete(ctx context.Context, recordID ratingmodel.RecordID, recordType ratingmodel.RecordType) error
+}
+
+// newCache creates the cache of aggregated ratings from the config along with a function returning its usage.
+func newCache(cfg cacheConfig) (aggregateCache, func() any, error) {
+	switch cfg.Type {
+	case "", "memory":
+		c := memory.New(cfg.MaxEntries, cfg.TTL)
+		return c, func() any { return c.Stats() }, nil
+	case "redis":
+		client := resp.NewClient(cfg.Redis.Address, cfg.Redis.PoolSize, cfg.Redis.Timeout)
+		c := redis.New(client, cfg.Redis.Namespace, cfg.TTL)
+		return c, func() any { return c.Stats() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cache type %q", cfg.Type)
+	}
+}
+
+type messageQueueIngester interface {
+	Ingest(ctx context.Context) (chan ingester.Message, error)
+}
+
+type messageQueuePublisher interface {
+	Publish(ctx context.Context, events []ratingmodel.RatingEvent) error
+}
+
+// newMessageQueue creates the ingester of rating events and the publisher of the outbox from the config.
+// The publisher is nil if rating changes made through the API are not published.
+func newMessageQueue(cfg config) (messageQueueIngester, messageQueuePublisher, error) {
+	mq := cfg.MessageQueue
+	switch mq.Type {
+	case "", "kafka":
+		in, err := kafka.NewIngester(mq.Address, mq.GroupID, mq.Topic, mq.DeadLetterTopic)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.Outbox.Topic == "" {
+			return in, nil, nil
+		}
+		contentType := ratingmodel.ContentTypeJSON
+		if cfg.Outbox.Format == "proto" {
+			contentType = ratingmodel.ContentTypeProto
+		}
+		return in, outboxkafka.NewPublisher(mq.Address, cfg.Outbox.Topic, contentType), nil
+	case "memory":
+		// Rating changes made through the API are the only events.
+		in := memoryingester.New(mq.BatchSize)
+		return in, in, nil
+	case "file":
+		in := fileingester.New(mq.File.Path, true, mq.File.PollInterval, mq.File.DeadLetterPath)
+		return in, in, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown message queue type %q", mq.Type)
+	}
+}
+
+// processedRetention returns how long the keys of processed events are kept.
+// Only Kafka moves its position forward and stops redelivering old events. The memory and file queues
+// deliver all their events again on every start, so their keys are kept forever.
+func processedRetention(mq messageQueueConfig) time.Duration {
+	if mq.Type != "" && mq.Type != "kafka" {
+		if mq.ProcessedRetention > 0 {
+			log.Printf("Ignoring the processed events retention, which only applies to Kafka")
+		}
+		return 0
+	}
+	return mq.ProcessedRetention
+}
+
+// newRegistry creates the service registry from the config.
+// A file registry is reloaded whenever its file changes, until ctx is done.
+func newRegistry(ctx context.Context, cfg serviceDiscoveryConfig) (discovery.Registry, error) {
+	switch cfg.Type {
+	case "", "consul":
+		r, err := consul.NewRegistry(cfg.Consul.Address)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "static":
+		services := map[model.ServiceName][]static.Endpoint{}
+		for name, endpoints := range cfg.Static {
+			services[model.ServiceName(name)] = endpoints
+		}
+		return static.NewRegistry(services), nil
+	case "file":
+		r, err := file.NewRegistry(cfg.File.Path, cfg.File.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		go r.Start(ctx)
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown service discovery type %q", cfg.Type)
+	}
+}
@@ -2,42 +2,75 @@ package memory
 
 import (
 	"context"
+	"maps"
+	"time"
 
+	"github.com/akkahshh24/movieapp/pkg/lru"
 	"github.com/akkahshh24/movieapp/rating/internal/cache"
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
 )
 
 // Cache defines a rating cache.
-// It stores aggregated ratings for records in memory.
+// It stores aggregated ratings for records in memory, evicting the least recently used ones when full.
+// It is safe for concurrent use.
 type Cache struct {
-	data map[model.RecordType]map[model.RecordID]float64
+	data *lru.Cache[key, *model.AggregatedRating]
 }
 
-// New creates a new memory cache.
-func New() *Cache {
-	return &Cache{data: map[model.RecordType]map[model.RecordID]float64{}}
+type key struct {
+	recordID   model.RecordID
+	recordType model.RecordType
 }
 
-// Get retrieves the aggregated rating for a given record.
-func (c *Cache) Get(_ context.Context, recordID model.RecordID, recordType model.RecordType) (float64, error) {
-	if _, ok := c.data[recordType]; !ok {
-		return 0, cache.ErrNotFound
-	}
+// New creates a new memory cache holding at most maxEntries aggregated ratings for ttl each.
+// The number of entries is unbounded if maxEntries is 0, and entries never expire if ttl is 0.
+func New(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{data: lru.New[key, *model.AggregatedRating](maxEntries, ttl)}
+}
 
-	rating, ok := c.data[recordType][recordID]
+// Get retrieves the aggregated rating for a given record.
+func (c *Cache) Get(_ context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
+	rating, ok := c.data.Get(key{recordID, recordType})
 	if !ok {
-		return 0, cache.ErrNotFound
+		return nil, cache.ErrNotFound
 	}
 
-	return rating, nil
+	// Return a copy, so that later updates of the cached rating do not race with the caller.
+	return clone(rating), nil
 }
 
 // Put adds or updates the aggregated rating for a given record.
-func (c *Cache) Put(_ context.Context, recordID model.RecordID, recordType model.RecordType, rating float64) error {
-	if _, ok := c.data[recordType]; !ok {
-		c.data[recordType] = map[model.RecordID]float64{}
-	}
+func (c *Cache) Put(_ context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.AggregatedRating) error {
+	c.data.Put(key{recordID, recordType}, clone(rating))
+	return nil
+}
+
+// Delete evicts the aggregated rating for a given record.
+func (c *Cache) Delete(_ context.Context, recordID model.RecordID, recordType model.RecordType) error {
+	c.data.Delete(key{recordID, recordType})
+	return nil
+}
 
-	c.data[recordType][recordID] = rating
+// Update applies fn to the cached aggregated rating of a given record.
+// It returns cache.ErrNotFound if the record is not cached, leaving it to be loaded on the next read.
+func (c *Cache) Update(_ context.Context, recordID model.RecordID, recordType model.RecordType, fn func(*model.AggregatedRating)) error {
+	ok := c.data.Update(key{recordID, recordType}, func(rating *model.AggregatedRating) *model.AggregatedRating {
+		fn(rating)
+		return rating
+	})
+	if !ok {
+		return cache.ErrNotFound
+	}
 	return nil
 }
+
+// Stats returns the usage of the cache.
+func (c *Cache) Stats() lru.Stats {
+	return c.data.Stats()
+}
+
+func clone(rating *model.AggregatedRating) *model.AggregatedRating {
+	res := *rating
+	res.Histogram = maps.Clone(rating.Histogram)
+	return &res
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/resp"
+	"github.com/akkahshh24/movieapp/rating/internal/cache"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Cache defines a rating cache stored in Redis or a compatible server, shared by all replicas of the service.
+// Aggregated ratings are stored as JSON under keys of the form: namespace:aggregate:recordType:recordID.
+type Cache struct {
+	client    *resp.Client
+	namespace string
+	ttl       time.Duration
+
+	hits, misses, errors atomic.Int64
+}
+
+// Stats describes the usage of the cache.
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Errors is the number of commands that failed, for example because the server is unreachable.
+	Errors int64 `json:"errors"`
+}
+
+// New creates a new Redis cache that stores aggregated ratings under the namespace for ttl each.
+// Entries never expire if ttl is 0.
+func New(client *resp.Client, namespace string, ttl time.Duration) *Cache {
+	return &Cache{client: client, namespace: namespace, ttl: ttl}
+}
+
+// Get retrieves the aggregated rating for a given record.
+func (c *Cache) Get(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
+	data, err := c.client.Get(ctx, c.key(recordID, recordType))
+	if errors.Is(err, resp.ErrNil) {
+		c.misses.Add(1)
+		return nil, cache.ErrNotFound
+	} else if err != nil {
+		c.errors.Add(1)
+		return nil, err
+	}
+
+	var rating model.AggregatedRating
+	if err := json.Unmarshal(data, &rating); err != nil {
+		c.errors.Add(1)
+		return nil, err
+	}
+	c.hits.Add(1)
+	return &rating, nil
+}
+
+// Put adds or updates the aggregated rating for a given record.
+func (c *Cache) Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.AggregatedRating) error {
+	data, err := json.Marshal(rating)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, c.key(recordID, recordType), data, c.ttl); err != nil {
+		c.errors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// Delete evicts the aggregated rating for a given record.
+func (c *Cache) Delete(ctx context.Context, recordID model.RecordID, recordType model.RecordType) error {
+	if _, err := c.client.Del(ctx, c.key(recordID, recordType)); err != nil {
+		c.errors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// Update evicts the aggregated rating of a given record instead of applying fn to it, as other replicas
+// may update it at the same time. The rating is loaded from the repository on the next read.
+// It returns cache.ErrNotFound, as there is no cached rating left to update.
+func (c *Cache) Update(ctx context.Context, recordID model.RecordID, recordType model.RecordType, _ func(*model.AggregatedRating)) error {
+	if err := c.Delete(ctx, recordID, recordType); err != nil {
+		return err
+	}
+	return cache.ErrNotFound
+}
+
+// Stats returns the usage of the cache.
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Errors: c.errors.Load()}
+}
+
+func (c *Cache) key(recordID model.RecordID, recordType model.RecordType) string {
+	return c.namespace + ":aggregate:" + string(recordType) + ":" + string(recordID)
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akkahshh24/movieapp/pkg/resp"
+	"github.com/akkahshh24/movieapp/rating/internal/cache"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	srv, err := resp.NewServer("localhost:0")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := resp.NewClient(srv.Addr(), 2, time.Second)
+	defer client.Close()
+	// Two replicas share the server.
+	replica1 := New(client, "test", time.Minute)
+	replica2 := New(client, "test", time.Minute)
+	other := New(client, "other", time.Minute)
+
+	_, err = replica1.Get(ctx, "1", model.RecordTypeMovie)
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	var rating model.AggregatedRating
+	rating.Add(5, 1)
+	rating.Add(4, 1)
+	assert.NoError(t, replica1.Put(ctx, "1", model.RecordTypeMovie, &rating))
+
+	got, err := replica2.Get(ctx, "1", model.RecordTypeMovie)
+	assert.NoError(t, err)
+	assert.Equal(t, &rating, got)
+
+	// Namespaces do not share entries.
+	_, err = other.Get(ctx, "1", model.RecordTypeMovie)
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	// An update on one replica is seen by the other.
+	err = replica2.Update(ctx, "1", model.RecordTypeMovie, func(a *model.AggregatedRating) { a.Add(1, 1) })
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = replica1.Get(ctx, "1", model.RecordTypeMovie)
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+
+	assert.Equal(t, Stats{Misses: 2}, replica1.Stats())
+	assert.Equal(t, Stats{Hits: 1}, replica2.Stats())
+}
@@ -0,0 +1,186 @@
+package rating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// ErrUnknownStrategy is returned when an aggregation strategy is not configured.
+var ErrUnknownStrategy = errors.New("unknown aggregation strategy")
+
+// Aggregation strategy names.
+const (
+	StrategyMean        = "mean"
+	StrategyBayesian    = "bayesian"
+	StrategyTrimmedMean = "trimmed_mean"
+	StrategyTimeDecay   = "time_decay"
+)
+
+// Strategy defines a way of aggregating the ratings of a record into a single value.
+type Strategy interface {
+	// Aggregate computes the rating value of a record.
+	Aggregate(ctx context.Context, in *AggregationInput) (float64, error)
+}
+
+// AggregationInput provides the data a strategy computes the rating value of a record from.
+// Data that is expensive to get is loaded on demand, so strategies only pay for what they use.
+type AggregationInput struct {
+	// Aggregate is the running aggregate of the record. It is never empty.
+	Aggregate *model.AggregatedRating
+	// Ratings loads the individual ratings of the record.
+	Ratings func(ctx context.Context) ([]model.Rating, error)
+	// TypeAggregate loads the running aggregate of all records of the same type.
+	TypeAggregate func(ctx context.Context) (*model.AggregatedRating, error)
+}
+
+// Aggregation defines which strategies are available and which one is used for each record type.
+type Aggregation struct {
+	// Strategies maps strategy names to their implementations.
+	Strategies map[string]Strategy
+	// RecordTypeStrategies maps record types to the name of the strategy used for them unless requested otherwise.
+	RecordTypeStrategies map[model.RecordType]string
+	// DefaultStrategy is the name of the strategy used for record types without one.
+	DefaultStrategy string
+}
+
+// DefaultAggregation returns an aggregation that offers all strategies and uses the arithmetic mean by default.
+func DefaultAggregation() Aggregation {
+	return Aggregation{
+		Strategies: map[string]Strategy{
+			StrategyMean:        MeanStrategy{},
+			StrategyBayesian:    BayesianStrategy{PriorWeight: 10},
+			StrategyTrimmedMean: TrimmedMeanStrategy{TrimRatio: 0.1},
+			StrategyTimeDecay:   TimeDecayStrategy{HalfLife: 30 * 24 * time.Hour},
+		},
+		DefaultStrategy: StrategyMean,
+	}
+}
+
+// Validate checks that every referenced strategy is available.
+func (a Aggregation) Validate() error {
+	if _, ok := a.Strategies[a.DefaultStrategy]; !ok {
+		return fmt.Errorf("default strategy %q: %w", a.DefaultStrategy, ErrUnknownStrategy)
+	}
+	for recordType, name := range a.RecordTypeStrategies {
+		if _, ok := a.Strategies[name]; !ok {
+			return fmt.Errorf("strategy %q of record type %q: %w", name, recordType, ErrUnknownStrategy)
+		}
+	}
+	return nil
+}
+
+// strategy returns the strategy with the given name or, if the name is empty, the one configured for the record type.
+func (a Aggregation) strategy(recordType model.RecordType, name string) (Strategy, error) {
+	if name == "" {
+		name = a.DefaultStrategy
+		if n, ok := a.RecordTypeStrategies[recordType]; ok {
+			name = n
+		}
+	}
+
+	s, ok := a.Strategies[name]
+	if !ok {
+		return nil, ErrUnknownStrategy
+	}
+	return s, nil
+}
+
+// weighted returns the total weight and the weighted sum of the ratings of an aggregate.
+// If no rating carries any weight, all ratings count the same.
+func weighted(a *model.AggregatedRating) (weight float64, sum float64) {
+	if a.Weight > 0 {
+		return a.Weight, a.WeightedSum
+	}
+	return float64(a.Count), float64(a.Sum)
+}
+
+// MeanStrategy aggregates ratings with the arithmetic mean, weighted by the trust in each rating.
+type MeanStrategy struct{}
+
+// Aggregate computes the weighted arithmetic mean of the ratings of a record.
+func (MeanStrategy) Aggregate(_ context.Context, in *AggregationInput) (float64, error) {
+	weight, sum := weighted(in.Aggregate)
+	return sum / weight, nil
+}
+
+// BayesianStrategy aggregates ratings with a Bayesian average, which pulls records with few ratings
+// towards the mean of all records of the same type.
+type BayesianStrategy struct {
+	// PriorWeight is the number of virtual ratings with the type-wide mean added to every record.
+	PriorWeight float64
+}
+
+// Aggregate computes the Bayesian average of the ratings of a record.
+func (s BayesianStrategy) Aggregate(ctx context.Context, in *AggregationInput) (float64, error) {
+	prior, err := in.TypeAggregate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	weight, sum := weighted(in.Aggregate)
+	return (s.PriorWeight*prior.Value + sum) / (s.PriorWeight + weight), nil
+}
+
+// TrimmedMeanStrategy aggregates ratings with a mean that ignores the most extreme ratings on both ends.
+// All ratings count the same, regardless of the trust in them.
+type TrimmedMeanStrategy struct {
+	// TrimRatio is the fraction of the lowest and of the highest ratings to ignore, from 0 to 0.5.
+	TrimRatio float64
+}
+
+// Aggregate computes the trimmed mean of the ratings of a record from its histogram.
+func (s TrimmedMeanStrategy) Aggregate(_ context.Context, in *AggregationInput) (float64, error) {
+	a := in.Aggregate
+	// Always keep at least one rating.
+	trim := min(int64(float64(a.Count)*s.TrimRatio), (a.Count-1)/2)
+
+	// Walk the ratings in ascending order and only count the ones ranked within [trim, count-trim).
+	var rank, count, sum int64
+	for _, v := range slices.Sorted(maps.Keys(a.Histogram)) {
+		n := a.Histogram[v]
+		if kept := min(rank+n, a.Count-trim) - max(rank, trim); kept > 0 {
+			count += kept
+			sum += kept * int64(v)
+		}
+		rank += n
+	}
+	return float64(sum) / float64(count), nil
+}
+
+// TimeDecayStrategy aggregates ratings with a weighted mean in which the weight of a rating decays
+// exponentially with its age, starting from the trust in the rating.
+type TimeDecayStrategy struct {
+	// HalfLife is the age at which a rating counts half as much as a new one.
+	HalfLife time.Duration
+}
+
+// Aggregate computes the time-decayed mean of the ratings of a record.
+func (s TimeDecayStrategy) Aggregate(ctx context.Context, in *AggregationInput) (float64, error) {
+	ratings, err := in.Ratings(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var weights, sum float64
+	for _, r := range ratings {
+		w := r.Weight
+		if s.HalfLife > 0 {
+			w *= math.Exp2(-now.Sub(r.UpdatedAt).Seconds() / s.HalfLife.Seconds())
+		}
+		weights += w
+		sum += w * float64(r.Value)
+	}
+
+	// All ratings are too old to carry any weight, so none of them is preferred.
+	if weights == 0 {
+		return MeanStrategy{}.Aggregate(ctx, in)
+	}
+	return sum / weights, nil
+}
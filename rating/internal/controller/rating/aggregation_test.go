@@ -0,0 +1,71 @@
+package rating
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrategies(t *testing.T) {
+	now := time.Now()
+	ratings := []model.Rating{
+		{Value: 1, Weight: 1, UpdatedAt: now.Add(-48 * time.Hour)},
+		{Value: 4, Weight: 1, UpdatedAt: now},
+		{Value: 4, Weight: 1, UpdatedAt: now},
+		{Value: 5, Weight: 1, UpdatedAt: now},
+	}
+	aggregate := &model.AggregatedRating{}
+	for _, r := range ratings {
+		aggregate.Add(r.Value, r.Weight)
+	}
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		want     float64
+	}{
+		{
+			name:     "mean",
+			strategy: MeanStrategy{},
+			want:     3.5,
+		},
+		{
+			name:     "bayesian",
+			strategy: BayesianStrategy{PriorWeight: 4},
+			want:     (4*2.5 + 14) / 8.0,
+		},
+		{
+			name:     "trimmed mean",
+			strategy: TrimmedMeanStrategy{TrimRatio: 0.25},
+			want:     4,
+		},
+		{
+			name:     "trimmed mean keeps the median",
+			strategy: TrimmedMeanStrategy{TrimRatio: 0.5},
+			want:     4,
+		},
+		{
+			name:     "time decay",
+			strategy: TimeDecayStrategy{HalfLife: 24 * time.Hour},
+			want:     (0.25*1 + 4 + 4 + 5) / 3.25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Aggregate(context.Background(), &AggregationInput{
+				Aggregate: aggregate,
+				Ratings: func(context.Context) ([]model.Rating, error) {
+					return ratings, nil
+				},
+				TypeAggregate: func(context.Context) (*model.AggregatedRating, error) {
+					return &model.AggregatedRating{Value: 2.5}, nil
+				},
+			})
+			assert.NoError(t, err, tt.name)
+			assert.InDelta(t, tt.want, got, 1e-6, tt.name)
+		})
+	}
+}
@@ -2,10 +2,17 @@ package rating
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
+	"github.com/akkahshh24/movieapp/pkg/loader"
+	"github.com/akkahshh24/movieapp/rating/internal/cache"
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
 	"github.com/akkahshh24/movieapp/rating/internal/repository"
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
 )
@@ -15,32 +22,108 @@ var ErrNotFound = errors.New("ratings not found for a record")
 
 type ratingRepository interface {
 	Get(ctx context.Context, recordID model.RecordID, recordType model.RecordType) ([]model.Rating, error)
-	Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating) error
+	GetAggregate(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error)
+	GetTypeAggregate(ctx context.Context, recordType model.RecordType) (*model.AggregatedRating, error)
+	ListHistory(ctx context.Context, recordID model.RecordID, recordType model.RecordType, query repository.HistoryQuery) ([]model.Rating, error)
+	ListByUser(ctx context.Context, userID model.UserID, query repository.UserRatingsQuery) ([]model.Rating, error)
+	Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating, event *model.RatingEvent, processedKey string) (*model.Rating, error)
+	Delete(ctx context.Context, recordID model.RecordID, recordType model.RecordType, userID model.UserID, providerID string, event *model.RatingEvent, processedKey string) (*model.Rating, error)
+	PutBatch(ctx context.Context, ratings []model.Rating, processedKeys []string) error
+	DeleteByProvider(ctx context.Context, providerID string, newEvent func(model.Rating) *model.RatingEvent) ([]model.Rating, error)
+	ProcessedEvents(ctx context.Context, keys []string) (map[string]bool, error)
+	MarkEventsProcessed(ctx context.Context, keys []string) error
+	PruneProcessedEvents(ctx context.Context, before time.Time) (int64, error)
 }
 
 type ratingCache interface {
-	Get(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (float64, error)
-	Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating float64) error
+	Get(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error)
+	Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.AggregatedRating) error
+	Update(ctx context.Context, recordID model.RecordID, recordType model.RecordType, fn func(*model.AggregatedRating)) error
+	Delete(ctx context.Context, recordID model.RecordID, recordType model.RecordType) error
 }
 
 type ratingIngester interface {
-	Ingest(ctx context.Context) (chan model.RatingEvent, error)
+	Ingest(ctx context.Context) (chan ingester.Message, error)
 }
 
 // Controller defines a rating service controller.
 type Controller struct {
-	repo     ratingRepository
-	cache    ratingCache
-	ingester ratingIngester
+	repo        ratingRepository
+	cache       ratingCache
+	ingester    ratingIngester
+	aggregation Aggregation
+	recordTypes RecordTypeRegistry
+	ingestion   IngestionConfig
+
+	ingestionCounters ingestionCounters
+
+	// loader reads the aggregates missing from the cache.
+	loader *loader.Loader[*model.AggregatedRating]
+
+	typeAggregatesMu sync.Mutex
+	typeAggregates   map[model.RecordType]typeAggregate
+}
+
+// typeAggregateTTL defines how long a type-wide aggregate is reused before it is reloaded.
+const typeAggregateTTL = time.Minute
+
+type typeAggregate struct {
+	aggregate *model.AggregatedRating
+	loadedAt  time.Time
 }
 
+// maxMissing is the number of records that are remembered as having no ratings at most.
+const maxMissing = 10000
+
 // New creates a rating service controller.
-func New(repo ratingRepository, cache ratingCache, ingester ratingIngester) *Controller {
-	return &Controller{repo, cache, ingester}
+// Records without ratings are remembered as such for negativeTTL, or not at all if it is 0.
+func New(repo ratingRepository, cache ratingCache, ingester ratingIngester, aggregation Aggregation, recordTypes RecordTypeRegistry, ingestion IngestionConfig, negativeTTL time.Duration) *Controller {
+	return &Controller{
+		repo:           repo,
+		cache:          cache,
+		ingester:       ingester,
+		aggregation:    aggregation,
+		recordTypes:    recordTypes,
+		ingestion:      ingestion,
+		loader:         loader.New[*model.AggregatedRating](ErrNotFound, negativeTTL, maxMissing),
+		typeAggregates: map[model.RecordType]typeAggregate{},
+	}
 }
 
 // GetAggregatedRating returns the aggregated rating for a record or ErrNotFound if there are no ratings for it.
-func (c *Controller) GetAggregatedRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (float64, error) {
+// The rating value is computed with the named strategy or, if strategy is empty, the one configured for the record type.
+func (c *Controller) GetAggregatedRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, strategy string) (*model.AggregatedRating, error) {
+	s, err := c.aggregation.strategy(recordType, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregatedRating, err := c.getAggregate(ctx, recordID, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.Aggregate(ctx, &AggregationInput{
+		Aggregate: aggregatedRating,
+		Ratings: func(ctx context.Context) ([]model.Rating, error) {
+			return c.repo.Get(ctx, recordID, recordType)
+		},
+		TypeAggregate: func(ctx context.Context) (*model.AggregatedRating, error) {
+			return c.getTypeAggregate(ctx, recordType)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aggregate ratings: %w", err)
+	}
+
+	// Return a copy, as the aggregate may be shared with the cache.
+	res := *aggregatedRating
+	res.Value = value
+	return &res, nil
+}
+
+// getAggregate returns the running aggregate of a record from the cache or the repository.
+func (c *Controller) getAggregate(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
 	// Get the aggregated rating from the cache first.
 	cacheRes, err := c.cache.Get(ctx, recordID, recordType)
 	if err == nil {
@@ -48,67 +131,259 @@ func (c *Controller) GetAggregatedRating(ctx context.Context, recordID model.Rec
 		return cacheRes, nil
 	}
 
-	ratings, err := c.repo.Get(ctx, recordID, recordType)
-	if err != nil && err == repository.ErrNotFound {
-		return 0, ErrNotFound
-	} else if err != nil {
-		return 0, err
+	// Concurrent misses for the same record share a single read of the repository.
+	return c.loader.Load(ctx, loaderKey(recordID, recordType), func(ctx context.Context) (*model.AggregatedRating, error) {
+		// Read the running aggregate maintained by the repository instead of rescanning all ratings.
+		aggregatedRating, err := c.repo.GetAggregate(ctx, recordID, recordType)
+		if err != nil && err == repository.ErrNotFound {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		return aggregatedRating, nil
+	}, func(ctx context.Context, aggregatedRating *model.AggregatedRating) {
+		// Update the cache with the aggregated rating.
+		if err := c.cache.Put(ctx, recordID, recordType, aggregatedRating); err != nil {
+			log.Println("Error updating cache with aggregated rating:", err.Error())
+		}
+	})
+}
+
+// LoaderMetrics returns how many repository reads were avoided on cache misses.
+func (c *Controller) LoaderMetrics() loader.Metrics {
+	return c.loader.Metrics()
+}
+
+// loaderKey identifies a record in the loader.
+func loaderKey(recordID model.RecordID, recordType model.RecordType) string {
+	return string(recordType) + "/" + string(recordID)
+}
+
+// getTypeAggregate returns the running aggregate of all records of a type.
+// It changes slowly and is expensive to load, so it is reused for typeAggregateTTL.
+func (c *Controller) getTypeAggregate(ctx context.Context, recordType model.RecordType) (*model.AggregatedRating, error) {
+	c.typeAggregatesMu.Lock()
+	defer c.typeAggregatesMu.Unlock()
+
+	if t, ok := c.typeAggregates[recordType]; ok && time.Since(t.loadedAt) < typeAggregateTTL {
+		return t.aggregate, nil
+	}
+
+	a, err := c.repo.GetTypeAggregate(ctx, recordType)
+	if err != nil {
+		return nil, err
 	}
+	c.typeAggregates[recordType] = typeAggregate{aggregate: a, loadedAt: time.Now()}
+	return a, nil
+}
+
+// PutRating writes a rating for a given record, replacing any previous rating of the same user.
+// It reports whether a new rating was created rather than an existing one updated.
+// It returns a *ValidationError if the rating does not fit the scale of the record type.
+// The change is published as a rating event.
+func (c *Controller) PutRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating) (bool, error) {
+	// Ratings made through the API do not come from a provider and are fully trusted.
+	r := *rating
+	r.ProviderID, r.Weight = "", 1
+	return c.putRating(ctx, recordID, recordType, &r, "")
+}
 
-	sum := float64(0)
-	for _, r := range ratings {
-		sum += float64(r.Value)
+// putRating writes a rating for a given record. A change made through the API, with an empty ingestedKey,
+// is published through the outbox. A change that comes from an ingested event is not published, as it has
+// been published already, but the event is marked as processed along with the change.
+// It returns an error wrapping repository.ErrNotOwned if the provider of the rating may not replace the previous one.
+func (c *Controller) putRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating, ingestedKey string) (bool, error) {
+	if err := c.recordTypes.validateRating(recordID, recordType, rating); err != nil {
+		return false, err
 	}
 
-	aggregatedRating := sum / float64(len(ratings))
+	// Loads of the aggregate in the meantime must not cache it, as the change is applied to the cached copy.
+	defer c.loader.Write(loaderKey(recordID, recordType))()
 
-	// Update the cache with the aggregated rating.
-	if err := c.cache.Put(ctx, recordID, recordType, aggregatedRating); err != nil {
+	var event *model.RatingEvent
+	if ingestedKey == "" {
+		event = newRatingEvent(recordID, recordType, rating.UserID, rating.Value, model.RatingEventTypePut)
+	}
+	prev, err := c.repo.Put(ctx, recordID, recordType, rating, event, ingestedKey)
+	if err != nil {
+		return false, fmt.Errorf("put rating: %w", err)
+	}
+
+	// Apply the change to the cached aggregated rating instead of recomputing it.
+	err = c.cache.Update(ctx, recordID, recordType, func(a *model.AggregatedRating) {
+		if prev != nil {
+			a.Remove(prev.Value, prev.Weight)
+		}
+		a.Add(rating.Value, rating.Weight)
+	})
+	if err != nil && !errors.Is(err, cache.ErrNotFound) {
 		log.Println("Error updating cache with aggregated rating:", err.Error())
 	}
 
-	return aggregatedRating, nil
+	return prev == nil, nil
 }
 
-// PutRating writes a rating for a given record.
-func (c *Controller) PutRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating) error {
-	if err := c.repo.Put(ctx, recordID, recordType, rating); err != nil {
-		return fmt.Errorf("put rating: %w", err)
-	}
+// DeleteRating removes a user's rating for a given record or returns ErrNotFound if the user has not rated it.
+// The change is published as a rating event.
+func (c *Controller) DeleteRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, userID model.UserID) error {
+	return c.deleteRating(ctx, recordID, recordType, userID, "", "")
+}
+
+// deleteRating removes a user's rating for a given record on behalf of a provider. As with putRating, the change
+// is published if ingestedKey is empty, and the ingested event is marked as processed otherwise.
+// It returns an error wrapping repository.ErrNotOwned if the provider may not remove the rating.
+func (c *Controller) deleteRating(ctx context.Context, recordID model.RecordID, recordType model.RecordType, userID model.UserID, providerID string, ingestedKey string) error {
+	// Loads of the aggregate in the meantime must not cache it, as the change is applied to the cached copy.
+	defer c.loader.Write(loaderKey(recordID, recordType))()
 
-	ratings, err := c.repo.Get(ctx, recordID, recordType)
-	if err != nil && err == repository.ErrNotFound {
+	var event *model.RatingEvent
+	if ingestedKey == "" {
+		event = newRatingEvent(recordID, recordType, userID, 0, model.RatingEventTypeDelete)
+	}
+	prev, err := c.repo.Delete(ctx, recordID, recordType, userID, providerID, event, ingestedKey)
+	if err != nil && errors.Is(err, repository.ErrNotFound) {
 		return ErrNotFound
 	} else if err != nil {
-		return err
+		return fmt.Errorf("delete rating: %w", err)
 	}
 
-	sum := float64(0)
-	for _, r := range ratings {
-		sum += float64(r.Value)
+	// Apply the change to the cached aggregated rating instead of recomputing it.
+	var empty bool
+	err = c.cache.Update(ctx, recordID, recordType, func(a *model.AggregatedRating) {
+		a.Remove(prev.Value, prev.Weight)
+		empty = a.Count == 0
+	})
+	if err != nil && !errors.Is(err, cache.ErrNotFound) {
+		log.Println("Error updating cache with aggregated rating:", err.Error())
 	}
 
-	aggregatedRating := sum / float64(len(ratings))
-
-	// Update the cache with the aggregated rating.
-	if err := c.cache.Put(ctx, recordID, recordType, aggregatedRating); err != nil {
-		fmt.Println("Error updating cache with aggregated rating:", err.Error())
+	// The last rating of the record is gone, so there is nothing left to aggregate.
+	if empty {
+		if err := c.cache.Delete(ctx, recordID, recordType); err != nil {
+			log.Println("Error evicting aggregated rating from cache:", err.Error())
+		}
 	}
 
 	return nil
 }
 
-// StartIngestion starts the ingestion of rating events.
-func (s *Controller) StartIngestion(ctx context.Context) error {
-	ch, err := s.ingester.Ingest(ctx)
+// PurgeProvider removes all ratings ingested from a given provider and returns how many were removed.
+// Each removal is published as a rating event.
+func (c *Controller) PurgeProvider(ctx context.Context, providerID string) (int, error) {
+	// The touched records are only known once their ratings are removed, but newEvent is called before the
+	// removals are visible, which is early enough to mark the records as being written.
+	writes := map[string]func(){}
+	defer func() {
+		for _, done := range writes {
+			done()
+		}
+	}()
+	deleted, err := c.repo.DeleteByProvider(ctx, providerID, func(r model.Rating) *model.RatingEvent {
+		if key := loaderKey(r.RecordID, r.RecordType); writes[key] == nil {
+			writes[key] = c.loader.Write(key)
+		}
+		return newRatingEvent(r.RecordID, r.RecordType, r.UserID, 0, model.RatingEventTypeDelete)
+	})
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("delete ratings by provider: %w", err)
+	}
+
+	// The aggregates of the touched records have been recomputed, so their cached copies are stale.
+	for _, r := range deleted {
+		if err := c.cache.Delete(ctx, r.RecordID, r.RecordType); err != nil && !errors.Is(err, cache.ErrNotFound) {
+			log.Println("Error evicting aggregated rating from cache:", err.Error())
+		}
 	}
-	for e := range ch {
-		fmt.Printf("Consumed a message: %v\n", e)
-		if err := s.PutRating(ctx, e.RecordID, e.RecordType, &model.Rating{UserID: e.UserID, Value: e.Value}); err != nil {
-			return err
+	return len(deleted), nil
+}
+
+// ListRatingHistory returns a page of the ratings of a record last updated within [start, end) ordered by update time.
+// Zero start or end leave the range open. It also returns the token of the next page, which is empty on the last page.
+func (c *Controller) ListRatingHistory(ctx context.Context, recordID model.RecordID, recordType model.RecordType, start, end time.Time, size int, pageToken string) ([]model.Rating, string, error) {
+	// Ask for one more rating than requested to find out whether there is a next page.
+	query := repository.HistoryQuery{Start: start, End: end, Limit: pageSize(size) + 1}
+	if pageToken != "" {
+		query.After = &repository.HistoryCursor{}
+		if err := decodePageToken(pageToken, query.After); err != nil {
+			return nil, "", err
 		}
 	}
-	return nil
+
+	ratings, err := c.repo.ListHistory(ctx, recordID, recordType, query)
+	if err != nil {
+		return nil, "", fmt.Errorf("list rating history: %w", err)
+	}
+	if len(ratings) < query.Limit {
+		return ratings, "", nil
+	}
+
+	ratings = ratings[:query.Limit-1]
+	last := ratings[len(ratings)-1]
+	nextPageToken, err := encodePageToken(repository.HistoryCursor{UpdatedAt: last.UpdatedAt, UserID: last.UserID})
+	if err != nil {
+		return nil, "", err
+	}
+	return ratings, nextPageToken, nil
+}
+
+// userRatingsPageToken defines the content of a ListUserRatings page token.
+// It includes the order of the ratings, so that it cannot be used with a different one.
+type userRatingsPageToken struct {
+	SortBy     repository.RatingSort        `json:"sortBy"`
+	Descending bool                         `json:"descending"`
+	After      repository.UserRatingsCursor `json:"after"`
+}
+
+// ListUserRatings returns a page of the ratings of a user, optionally limited to records of a given type,
+// sorted by "time" (default) or "value". It also returns the token of the next page, which is empty on the last page.
+func (c *Controller) ListUserRatings(ctx context.Context, userID model.UserID, recordType model.RecordType, sort string, descending bool, size int, pageToken string) ([]model.Rating, string, error) {
+	sortBy := repository.RatingSort(sort)
+	if sortBy == "" {
+		sortBy = repository.RatingSortTime
+	} else if sortBy != repository.RatingSortTime && sortBy != repository.RatingSortValue {
+		return nil, "", ErrInvalidSort
+	}
+
+	// Ask for one more rating than requested to find out whether there is a next page.
+	query := repository.UserRatingsQuery{RecordType: recordType, SortBy: sortBy, Descending: descending, Limit: pageSize(size) + 1}
+	if pageToken != "" {
+		var token userRatingsPageToken
+		if err := decodePageToken(pageToken, &token); err != nil {
+			return nil, "", err
+		} else if token.SortBy != sortBy || token.Descending != descending {
+			return nil, "", ErrInvalidPageToken
+		}
+		query.After = &token.After
+	}
+
+	ratings, err := c.repo.ListByUser(ctx, userID, query)
+	if err != nil {
+		return nil, "", fmt.Errorf("list user ratings: %w", err)
+	}
+	if len(ratings) < query.Limit {
+		return ratings, "", nil
+	}
+
+	ratings = ratings[:query.Limit-1]
+	last := ratings[len(ratings)-1]
+	nextPageToken, err := encodePageToken(userRatingsPageToken{
+		SortBy:     sortBy,
+		Descending: descending,
+		After:      repository.UserRatingsCursor{Value: last.Value, UpdatedAt: last.UpdatedAt, RecordType: last.RecordType, RecordID: last.RecordID},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return ratings, nextPageToken, nil
+}
+
+// newRatingEvent creates a rating event with a random id for a change made through the API.
+func newRatingEvent(recordID model.RecordID, recordType model.RecordType, userID model.UserID, value model.RatingValue, eventType model.RatingEventType) *model.RatingEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &model.RatingEvent{
+		Rating:    model.Rating{RecordID: recordID, RecordType: recordType, UserID: userID, Value: value},
+		EventID:   hex.EncodeToString(id),
+		EventType: eventType,
+	}
 }
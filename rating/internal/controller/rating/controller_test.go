@@ -0,0 +1,56 @@
+package rating
+
+import (
+	"context"
+	"testing"
+
+	cachememory "github.com/akkahshh24/movieapp/rating/internal/cache/memory"
+	repomemory "github.com/akkahshh24/movieapp/rating/internal/repository/memory"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingRepository holds the reads of aggregates after they are done until it is released.
+type blockingRepository struct {
+	*repomemory.Repository
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRepository) GetAggregate(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
+	res, err := r.Repository.GetAggregate(ctx, recordID, recordType)
+	r.read <- struct{}{}
+	<-r.release
+	return res, err
+}
+
+func TestPurgeProviderRacingGet(t *testing.T) {
+	ctx := context.Background()
+	repo := &blockingRepository{Repository: repomemory.New(), read: make(chan struct{}), release: make(chan struct{})}
+	ctrl := New(repo, cachememory.New(0, 0), nil, DefaultAggregation(), DefaultRecordTypeRegistry(), DefaultIngestionConfig(), 0)
+	_, err := repo.Put(ctx, "1", model.RecordTypeMovie, &model.Rating{UserID: "alice", Value: 5, ProviderID: "partner", Weight: 1}, nil, "")
+	assert.NoError(t, err)
+	_, err = repo.Put(ctx, "1", model.RecordTypeMovie, &model.Rating{UserID: "bob", Value: 1, Weight: 1}, nil, "")
+	assert.NoError(t, err)
+
+	// The aggregate is read before the purge, but returned after it.
+	got := make(chan *model.AggregatedRating)
+	go func() {
+		res, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+		assert.NoError(t, err)
+		got <- res
+	}()
+	<-repo.read
+	n, err := ctrl.PurgeProvider(ctx, "partner")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	close(repo.release)
+	assert.Equal(t, int64(2), (<-got).Count)
+
+	// The aggregate read before the purge is not cached.
+	go func() { <-repo.read }()
+	res, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.Count)
+	assert.Equal(t, 1.0, res.Value)
+}
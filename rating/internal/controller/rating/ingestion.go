@@ -0,0 +1,449 @@
+package rating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/internal/cache"
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
+	"github.com/akkahshh24/movieapp/rating/internal/repository"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// IngestionConfig defines how ingested rating events are processed.
+type IngestionConfig struct {
+	// Workers is the number of events processed in parallel.
+	Workers int
+	// BatchSize is the number of events each worker stores at once. It is also the number of
+	// events that can be queued for each worker.
+	BatchSize int
+	// FlushInterval is how long a worker waits for a batch to fill up before storing it.
+	FlushInterval time.Duration
+	Retry         RetryPolicy
+	// Providers are the providers whose events are ingested.
+	Providers ProviderRegistry
+	// ProcessedRetention is how long the keys of processed events are kept to skip their redeliveries.
+	// It must exceed how long the message queue may redeliver the events, so it only suits queues that
+	// move their position forward, such as Kafka. The keys are kept forever if it is 0.
+	ProcessedRetention time.Duration
+}
+
+// DefaultIngestionConfig returns an ingestion config with a few workers and the default retry policy,
+// which keeps the keys of processed events forever.
+func DefaultIngestionConfig() IngestionConfig {
+	return IngestionConfig{Workers: 4, BatchSize: 100, FlushInterval: 50 * time.Millisecond, Retry: DefaultRetryPolicy()}
+}
+
+// pruneInterval is how often the keys of processed events older than the retention are removed.
+const pruneInterval = time.Hour
+
+// IngestionMetrics describes the progress of the ingestion and the backpressure on it.
+type IngestionMetrics struct {
+	// Queued is the number of events waiting for a worker.
+	Queued int64 `json:"queued"`
+	// Processed is the number of events that have been stored.
+	Processed int64 `json:"processed"`
+	// Rejected is the number of events that have been moved to the dead-letter queue.
+	Rejected int64 `json:"rejected"`
+	// Blocked is the number of times an event waited for a full worker queue.
+	Blocked int64 `json:"blocked"`
+	// BlockedTime is the total time events waited for full worker queues.
+	BlockedTime time.Duration `json:"blockedTime"`
+}
+
+type ingestionCounters struct {
+	queued, processed, rejected, blocked, blockedTime atomic.Int64
+}
+
+// IngestionMetrics returns a snapshot of the ingestion metrics.
+func (s *Controller) IngestionMetrics() IngestionMetrics {
+	return IngestionMetrics{
+		Queued:      s.ingestionCounters.queued.Load(),
+		Processed:   s.ingestionCounters.processed.Load(),
+		Rejected:    s.ingestionCounters.rejected.Load(),
+		Blocked:     s.ingestionCounters.blocked.Load(),
+		BlockedTime: time.Duration(s.ingestionCounters.blockedTime.Load()),
+	}
+}
+
+// RetryPolicy defines how an ingested event that failed to be processed is retried
+// before it is moved to the dead-letter queue.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times an event is processed at most.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles with every further retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns a retry policy that gives up after 5 attempts within a few seconds.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}
+}
+
+// backoff returns the delay after the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// StartIngestion starts the ingestion of rating events.
+// Events are acknowledged only after they have been stored, so an event is redelivered
+// rather than lost if the service stops while processing it. Events that keep failing
+// are moved to the dead-letter queue, so they do not block the ones behind them.
+//
+// Events are distributed to workers by record, so the events of a record are processed
+// in order while the events of different records are processed in parallel.
+func (s *Controller) StartIngestion(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch, err := s.ingester.Ingest(ctx)
+	if err != nil {
+		return err
+	}
+	if s.ingestion.ProcessedRetention > 0 {
+		go s.pruneProcessedEvents(ctx)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	queues := make([]chan ingester.Message, max(s.ingestion.Workers, 1))
+	for i := range queues {
+		queues[i] = make(chan ingester.Message, s.ingestion.BatchSize)
+		wg.Add(1)
+		go func(queue chan ingester.Message) {
+			defer wg.Done()
+			if err := s.worker(ctx, queue); err != nil {
+				// The worker only fails once the ingestion is stopped, so stop the other workers too.
+				errOnce.Do(func() { firstErr = err })
+				cancel()
+				// Drain the queue, so that the dispatch is not blocked.
+				for range queue {
+					s.ingestionCounters.queued.Add(-1)
+				}
+			}
+		}(queues[i])
+	}
+
+	for msg := range ch {
+		queue := queues[partition(msg.Event, len(queues))]
+		s.ingestionCounters.queued.Add(1)
+		select {
+		case queue <- msg:
+			continue
+		default:
+		}
+
+		// The worker is busy, so wait for room in its queue.
+		start := time.Now()
+		select {
+		case queue <- msg:
+		case <-ctx.Done():
+			s.ingestionCounters.queued.Add(-1)
+		}
+		s.ingestionCounters.blocked.Add(1)
+		s.ingestionCounters.blockedTime.Add(int64(time.Since(start)))
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	if firstErr != nil && !errors.Is(firstErr, context.Canceled) {
+		return firstErr
+	}
+	return nil
+}
+
+// partition returns the worker of an event, which is the same for all events of a record.
+func partition(e model.RatingEvent, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(e.RecordType))
+	h.Write([]byte{0})
+	h.Write([]byte(e.RecordID))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// worker processes the events of a queue in batches of up to BatchSize events,
+// flushing incomplete batches after FlushInterval.
+func (s *Controller) worker(ctx context.Context, queue chan ingester.Message) error {
+	timer := time.NewTimer(s.ingestion.FlushInterval)
+	timer.Stop()
+	defer timer.Stop()
+
+	var batch []ingester.Message
+	flush := func() error {
+		timer.Stop()
+		err := s.flush(ctx, batch)
+		batch = nil
+		return err
+	}
+
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				return flush()
+			}
+			s.ingestionCounters.queued.Add(-1)
+			fmt.Printf("Consumed a message: %v\n", msg.Event)
+
+			batch = append(batch, msg)
+			if len(batch) >= s.ingestion.BatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			} else if len(batch) == 1 {
+				timer.Reset(s.ingestion.FlushInterval)
+			}
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// flush stores a batch of ingested events in order and acknowledges or rejects them.
+func (s *Controller) flush(ctx context.Context, batch []ingester.Message) error {
+	var puts []ingester.Message
+	for _, msg := range batch {
+		if msg.Event.EventType != model.RatingEventTypeDelete {
+			puts = append(puts, msg)
+			continue
+		}
+
+		// Deletions are rare, so they are not batched. The puts before them are stored first,
+		// so that the events of a record are still applied in order.
+		if err := s.putBatch(ctx, puts); err != nil {
+			return err
+		}
+		puts = nil
+		if err := s.ingest(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return s.putBatch(ctx, puts)
+}
+
+// putBatch stores the ratings of a batch of put events at once and acknowledges or rejects them.
+func (s *Controller) putBatch(ctx context.Context, batch []ingester.Message) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(batch))
+	for i, msg := range batch {
+		keys[i] = msg.Key
+	}
+	processed, err := s.repo.ProcessedEvents(ctx, keys)
+	if err != nil {
+		log.Printf("Failed to look up a batch of %d events, storing them one by one: %v\n", len(batch), err)
+		return s.ingestEach(ctx, batch)
+	}
+
+	var valid []ingester.Message
+	var ratings []model.Rating
+	for _, msg := range batch {
+		// A redelivered event may have been superseded by a later one, so it must not be applied again.
+		// It is skipped before validation, as it may come from a provider that is no longer allowed.
+		if processed[msg.Key] {
+			log.Printf("Skipping already processed event %s\n", msg.Key)
+			s.ack(ctx, msg)
+			continue
+		}
+		rating, err := s.ingestedRating(&msg.Event)
+		if err != nil {
+			s.reject(ctx, msg, err, 1)
+			continue
+		}
+		valid = append(valid, msg)
+		ratings = append(ratings, *rating)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	if _, err := s.retry(ctx, "batch", func() error { return s.storeBatch(ctx, valid, ratings) }); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Store the events one by one, so that only the failing ones are rejected.
+		log.Printf("Failed to store a batch of %d events, storing them one by one: %v\n", len(valid), err)
+		return s.ingestEach(ctx, valid)
+	}
+
+	for _, msg := range valid {
+		s.ack(ctx, msg)
+	}
+	return nil
+}
+
+// storeBatch stores the ratings of a batch of valid put events and marks the events as processed at once.
+func (s *Controller) storeBatch(ctx context.Context, batch []ingester.Message, ratings []model.Rating) error {
+	// Loads of the touched aggregates in the meantime must not cache them.
+	for _, r := range ratings {
+		defer s.loader.Write(loaderKey(r.RecordID, r.RecordType))()
+	}
+	keys := make([]string, len(batch))
+	for i, msg := range batch {
+		keys[i] = msg.Key
+	}
+	if err := s.repo.PutBatch(ctx, ratings, keys); err != nil {
+		return fmt.Errorf("put ratings: %w", err)
+	}
+
+	// The aggregates of the touched records have been recomputed, so their cached copies are stale.
+	for _, r := range ratings {
+		if err := s.cache.Delete(ctx, r.RecordID, r.RecordType); err != nil && !errors.Is(err, cache.ErrNotFound) {
+			log.Println("Error evicting aggregated rating from cache:", err.Error())
+		}
+	}
+	return nil
+}
+
+// ingestEach processes the events of a batch one by one.
+func (s *Controller) ingestEach(ctx context.Context, batch []ingester.Message) error {
+	for _, msg := range batch {
+		if err := s.ingest(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ingest processes a single ingested event with retries and acknowledges or rejects it.
+func (s *Controller) ingest(ctx context.Context, msg ingester.Message) error {
+	attempts, err := s.retry(ctx, msg.Key, func() error { return s.process(ctx, msg) })
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.reject(ctx, msg, err, attempts)
+		return nil
+	}
+	s.ack(ctx, msg)
+	return nil
+}
+
+// retry calls fn until it succeeds, fails with an error that cannot succeed on a retry, or the
+// retry policy gives up. It returns the number of attempts and the last error.
+func (s *Controller) retry(ctx context.Context, name string, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		// Invalid events and changes of ratings owned by another provider cannot succeed on a retry.
+		var validationErr *ValidationError
+		if err == nil || errors.As(err, &validationErr) || errors.Is(err, repository.ErrNotOwned) || attempt >= s.ingestion.Retry.MaxAttempts {
+			return attempt, err
+		}
+
+		log.Printf("Failed to process %s (attempt %d): %v\n", name, attempt, err)
+		select {
+		case <-time.After(s.ingestion.Retry.backoff(attempt)):
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		}
+	}
+}
+
+// pruneProcessedEvents removes the keys of the events processed longer than the retention ago every
+// pruneInterval, until ctx is done.
+func (s *Controller) pruneProcessedEvents(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.repo.PruneProcessedEvents(ctx, time.Now().Add(-s.ingestion.ProcessedRetention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to prune processed events: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d processed events\n", n)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ack acknowledges a stored event.
+func (s *Controller) ack(ctx context.Context, msg ingester.Message) {
+	s.ingestionCounters.processed.Add(1)
+	// A failed acknowledgement only leads to a redelivery, which is skipped as already processed.
+	if err := msg.Ack(ctx); err != nil {
+		log.Printf("Failed to acknowledge event %s: %v\n", msg.Key, err)
+	}
+}
+
+// reject moves an event that failed to be processed to the dead-letter queue.
+// The queue cannot move past an event that is neither stored nor dead-lettered, so writing to the
+// dead-letter queue is retried with the backoff of the retry policy until it succeeds or the ingestion stops.
+func (s *Controller) reject(ctx context.Context, msg ingester.Message, cause error, attempts int) {
+	log.Printf("Rejecting event %s after %d attempts: %v\n", msg.Key, attempts, cause)
+	for attempt := 1; ; attempt++ {
+		err := msg.Reject(ctx, cause, attempts)
+		if err == nil {
+			s.ingestionCounters.rejected.Add(1)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		backoff := s.ingestion.Retry.backoff(attempt)
+		log.Printf("Failed to move event %s to the dead-letter queue (attempt %d), retrying in %v: %v\n", msg.Key, attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// process stores an ingested event unless it has been processed before.
+func (s *Controller) process(ctx context.Context, msg ingester.Message) error {
+	// A redelivered event may have been superseded by a later one, so it must not be applied again.
+	processed, err := s.repo.ProcessedEvents(ctx, []string{msg.Key})
+	if err != nil {
+		return err
+	}
+	if processed[msg.Key] {
+		log.Printf("Skipping already processed event %s\n", msg.Key)
+		return nil
+	}
+
+	e := msg.Event
+	switch e.EventType {
+	case model.RatingEventTypeDelete:
+		if _, err := s.ingestion.Providers.provider(&e); err != nil {
+			return err
+		}
+		// A retraction of a rating we never stored is not an error for the pipeline, but nothing marked it as processed.
+		err := s.deleteRating(ctx, e.RecordID, e.RecordType, e.UserID, e.ProviderID, msg.Key)
+		if errors.Is(err, ErrNotFound) {
+			return s.repo.MarkEventsProcessed(ctx, []string{msg.Key})
+		}
+		return err
+	default:
+		rating, err := s.ingestedRating(&e)
+		if err != nil {
+			return err
+		}
+		_, err = s.putRating(ctx, e.RecordID, e.RecordType, rating, msg.Key)
+		return err
+	}
+}
@@ -0,0 +1,311 @@
+package rating
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cachememory "github.com/akkahshh24/movieapp/rating/internal/cache/memory"
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
+	"github.com/akkahshh24/movieapp/rating/internal/ingester/file"
+	ingestermemory "github.com/akkahshh24/movieapp/rating/internal/ingester/memory"
+	repomemory "github.com/akkahshh24/movieapp/rating/internal/repository/memory"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testIngestionConfig() IngestionConfig {
+	return IngestionConfig{
+		Workers:       2,
+		BatchSize:     3,
+		FlushInterval: time.Millisecond,
+		Retry:         RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	}
+}
+
+func putEvent(eventID string, recordID model.RecordID, userID model.UserID, value model.RatingValue) model.RatingEvent {
+	return model.RatingEvent{
+		Rating:    model.Rating{RecordID: recordID, RecordType: model.RecordTypeMovie, UserID: userID, Value: value},
+		EventID:   eventID,
+		EventType: model.RatingEventTypePut,
+	}
+}
+
+func TestStartIngestion(t *testing.T) {
+	ctx := context.Background()
+	in := ingestermemory.New(10)
+	ctrl := New(repomemory.New(), cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), testIngestionConfig(), 0)
+
+	deleteEvent := putEvent("5", "1", "alice", 0)
+	deleteEvent.EventType = model.RatingEventTypeDelete
+	events := []model.RatingEvent{
+		putEvent("1", "1", "alice", 5),
+		putEvent("2", "1", "bob", 3),
+		putEvent("3", "2", "alice", 4),
+		// A redelivery must not overwrite the later rating of bob.
+		putEvent("4", "1", "bob", 1),
+		putEvent("2", "1", "bob", 3),
+		deleteEvent,
+		// Invalid ratings are rejected.
+		putEvent("6", "1", "carol", 9),
+	}
+	assert.NoError(t, in.Publish(ctx, events))
+	in.Close()
+
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+
+	got, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), got.Count)
+	assert.Equal(t, 1.0, got.Value)
+
+	got, err = ctrl.GetAggregatedRating(ctx, "2", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, got.Value)
+
+	if rejected := in.Rejected(); assert.Len(t, rejected, 1) {
+		assert.Equal(t, "6", rejected[0].EventID)
+	}
+	metrics := ctrl.IngestionMetrics()
+	assert.Equal(t, int64(6), metrics.Processed)
+	assert.Equal(t, int64(1), metrics.Rejected)
+	assert.Equal(t, int64(0), metrics.Queued)
+}
+
+func TestStartIngestionWithProviders(t *testing.T) {
+	ctx := context.Background()
+	in := ingestermemory.New(10)
+	cfg := testIngestionConfig()
+	cfg.Providers = ProviderRegistry{
+		"partner": {Scale: &Scale{Min: 1, Max: 10, Step: 1}, Weight: 3},
+		"trusted": {RecordTypes: []model.RecordType{model.RecordTypeMovie}, Weight: 1},
+	}
+	repo := repomemory.New()
+	ctrl := New(repo, cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), cfg, 0)
+	_, err := ctrl.PutRating(ctx, "1", model.RecordTypeMovie, &model.Rating{UserID: "dave", Value: 4})
+	assert.NoError(t, err)
+
+	event := func(eventID string, providerID string, userID model.UserID, value model.RatingValue) model.RatingEvent {
+		e := putEvent(eventID, "1", userID, value)
+		e.ProviderID = providerID
+		return e
+	}
+	deleteEvent := event("5", "trusted", "alice", 0)
+	deleteEvent.EventType = model.RatingEventTypeDelete
+	events := []model.RatingEvent{
+		// 10 on the scale of the partner is 5 stars.
+		event("1", "partner", "alice", 10),
+		event("2", "trusted", "bob", 1),
+		// Unknown providers are rejected.
+		event("3", "unknown", "carol", 5),
+		// Providers may not change the ratings of other providers or those made through the API.
+		event("4", "trusted", "alice", 2),
+		deleteEvent,
+		event("6", "partner", "dave", 10),
+	}
+	assert.NoError(t, in.Publish(ctx, events))
+	in.Close()
+
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+
+	got, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), got.Count)
+	assert.Equal(t, (3*5.0+1*1.0+1*4.0)/5, got.Value)
+	var rejected []string
+	for _, e := range in.Rejected() {
+		rejected = append(rejected, e.EventID)
+	}
+	assert.Equal(t, []string{"3", "4", "5", "6"}, rejected)
+
+	n, err := ctrl.PurgeProvider(ctx, "partner")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err = ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), got.Count)
+	assert.Equal(t, (1.0+4.0)/2, got.Value)
+
+	// The removal is published along with the rating made through the API.
+	outbox, err := repo.ListOutbox(ctx, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, outbox, 2) {
+		assert.Equal(t, model.UserID("alice"), outbox[1].Event.UserID)
+		assert.Equal(t, model.RatingEventTypeDelete, outbox[1].Event.EventType)
+	}
+}
+
+func TestStartIngestionWithProvidersReusingEventIDs(t *testing.T) {
+	ctx := context.Background()
+	in := ingestermemory.New(10)
+	cfg := testIngestionConfig()
+	cfg.Providers = ProviderRegistry{"partner": {}, "trusted": {}}
+	ctrl := New(repomemory.New(), cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), cfg, 0)
+
+	// Event ids are only unique within a provider, so neither event is skipped as a redelivery.
+	alice := putEvent("1", "1", "alice", 5)
+	alice.ProviderID = "partner"
+	bob := putEvent("1", "1", "bob", 3)
+	bob.ProviderID = "trusted"
+	assert.NoError(t, in.Publish(ctx, []model.RatingEvent{alice, bob}))
+	in.Close()
+
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+
+	got, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), got.Count)
+	assert.Equal(t, 4.0, got.Value)
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		from Scale
+		to   Scale
+		want map[model.RatingValue]model.RatingValue
+	}{
+		{
+			from: Scale{Min: 1, Max: 10, Step: 1},
+			to:   Scale{Min: 1, Max: 5, Step: 1},
+			want: map[model.RatingValue]model.RatingValue{1: 1, 3: 2, 5: 3, 8: 4, 10: 5},
+		},
+		// The steps of the target scale do not divide its range, so its highest value is 9.
+		{
+			from: Scale{Min: 1, Max: 5, Step: 1},
+			to:   Scale{Min: 0, Max: 10, Step: 3},
+			want: map[model.RatingValue]model.RatingValue{1: 0, 2: 3, 3: 6, 4: 9, 5: 9},
+		},
+		{
+			from: Scale{Min: 1, Max: 5, Step: 1},
+			to:   Scale{Min: 0, Max: 11, Step: 3},
+			want: map[model.RatingValue]model.RatingValue{1: 0, 2: 3, 3: 6, 4: 9, 5: 9},
+		},
+	}
+	for _, tt := range tests {
+		for v, want := range tt.want {
+			assert.Equal(t, want, normalize(v, tt.from, tt.to), "value %d from %v to %v", v, tt.from, tt.to)
+		}
+	}
+}
+
+func TestStartIngestionFromFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ratings.jsonl")
+	deadLetterPath := filepath.Join(dir, "ratings.dlq.jsonl")
+	data := `{"userId":"alice","recordId":"1","recordType":"movie","value":5,"eventType":"put"}
+not json
+{"userId":"bob","recordId":"1","recordType":"movie","value":2,"eventType":"put"}
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	repo := repomemory.New()
+	in := file.New(path, false, time.Millisecond, deadLetterPath)
+	ctrl := New(repo, cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), testIngestionConfig(), 0)
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+
+	got, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), got.Count)
+	assert.Equal(t, 3.5, got.Value)
+
+	deadLetters, err := os.ReadFile(deadLetterPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "not json\n", string(deadLetters))
+
+	// Reading the file again skips the events that have been processed.
+	assert.NoError(t, in.Publish(ctx, []model.RatingEvent{putEvent("", "1", "carol", 1)}))
+	ctrl = New(repo, cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), testIngestionConfig(), 0)
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+
+	got, err = ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), got.Count)
+	assert.Equal(t, 8.0/3, got.Value)
+}
+
+// stubIngester delivers messages from a channel.
+type stubIngester chan ingester.Message
+
+func (i stubIngester) Ingest(context.Context) (chan ingester.Message, error) {
+	return i, nil
+}
+
+func TestStartIngestionRetriesDeadLetterUntilItSucceeds(t *testing.T) {
+	ctx := context.Background()
+	in := make(stubIngester, 2)
+	ctrl := New(repomemory.New(), cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), testIngestionConfig(), 0)
+
+	var acked []string
+	var rejects int
+	message := func(e model.RatingEvent) ingester.Message {
+		return ingester.Message{
+			Event: e,
+			Key:   e.EventID,
+			Ack: func(context.Context) error {
+				acked = append(acked, e.EventID)
+				return nil
+			},
+			Reject: func(context.Context, error, int) error {
+				rejects++
+				// The dead-letter queue is unavailable for longer than the retry policy allows.
+				if rejects <= 2*testIngestionConfig().Retry.MaxAttempts {
+					return errors.New("dead-letter queue unavailable")
+				}
+				return nil
+			},
+		}
+	}
+	// Both events go to the same worker, as they are for the same record.
+	in <- message(putEvent("1", "1", "alice", 9))
+	in <- message(putEvent("2", "1", "bob", 4))
+	close(in)
+
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+	// The invalid event is dead-lettered once the queue is back, and the next one is stored.
+	assert.Equal(t, 2*testIngestionConfig().Retry.MaxAttempts+1, rejects)
+	assert.Equal(t, []string{"2"}, acked)
+	got, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, got.Value)
+	assert.Equal(t, int64(1), ctrl.IngestionMetrics().Rejected)
+}
+
+func TestStartIngestionPrunesProcessedEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := repomemory.New()
+	assert.NoError(t, repo.MarkEventsProcessed(ctx, []string{"/1"}))
+	in := make(stubIngester)
+	cfg := testIngestionConfig()
+	cfg.ProcessedRetention = time.Nanosecond
+	ctrl := New(repo, cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), cfg, 0)
+
+	done := make(chan error)
+	go func() { done <- ctrl.StartIngestion(ctx) }()
+	// The queue no longer redelivers events older than the retention, so their keys are removed.
+	assert.Eventually(t, func() bool {
+		processed, err := repo.ProcessedEvents(ctx, []string{"/1"})
+		return err == nil && !processed["/1"]
+	}, time.Second, time.Millisecond)
+	close(in)
+	assert.NoError(t, <-done)
+}
+
+func TestStartIngestionKeepsProcessedEventsWithoutRetention(t *testing.T) {
+	ctx := context.Background()
+	repo := repomemory.New()
+	event := putEvent("1", "1", "alice", 4)
+	assert.NoError(t, repo.MarkEventsProcessed(ctx, []string{event.Key()}))
+	in := ingestermemory.New(10)
+	// A queue that delivers its events again on every start must not apply them twice.
+	assert.NoError(t, in.Publish(ctx, []model.RatingEvent{event}))
+	in.Close()
+	ctrl := New(repo, cachememory.New(0, 0), in, DefaultAggregation(), DefaultRecordTypeRegistry(), DefaultIngestionConfig(), 0)
+	assert.NoError(t, ctrl.StartIngestion(ctx))
+
+	_, err := ctrl.GetAggregatedRating(ctx, "1", model.RecordTypeMovie, StrategyMean)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,48 @@
+package rating
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidPageToken is returned when a page token cannot be decoded or does not match the request.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ErrInvalidSort is returned when an unsupported sort order is requested.
+var ErrInvalidSort = errors.New("invalid sort order")
+
+// Page size limits.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageSize returns the requested page size bounded by the page size limits.
+func pageSize(requested int) int {
+	if requested <= 0 {
+		return defaultPageSize
+	}
+	return min(requested, maxPageSize)
+}
+
+// encodePageToken encodes a cursor into an opaque page token.
+func encodePageToken(cursor any) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodePageToken decodes a page token into a cursor.
+func decodePageToken(token string, cursor any) error {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ErrInvalidPageToken
+	}
+	if err := json.Unmarshal(b, cursor); err != nil {
+		return ErrInvalidPageToken
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Provider defines how the ratings ingested from a provider are accepted.
+type Provider struct {
+	// RecordTypes lists the record types the provider may rate. All record types are allowed if it is empty.
+	RecordTypes []model.RecordType
+	// Scale is the rating scale of the provider, whose values are mapped to the scale of the record type.
+	// The scale of the record type is used if it is nil.
+	Scale *Scale
+	// Weight is the trust in the ratings of the provider, relative to a rating made through the API.
+	Weight float64
+}
+
+// ProviderRegistry defines the providers whose rating events are ingested.
+// Events of all providers are ingested with a weight of 1 if the registry is empty.
+type ProviderRegistry map[string]Provider
+
+// Validate checks that every provider of the registry is well-formed.
+func (r ProviderRegistry) Validate() error {
+	for providerID, p := range r {
+		if p.Scale != nil && (p.Scale.Min >= p.Scale.Max || p.Scale.Step <= 0) {
+			return fmt.Errorf("invalid scale of provider %q: min %d, max %d, step %d", providerID, p.Scale.Min, p.Scale.Max, p.Scale.Step)
+		}
+		if p.Weight < 0 {
+			return fmt.Errorf("invalid weight of provider %q: %v", providerID, p.Weight)
+		}
+	}
+	return nil
+}
+
+// provider returns the provider of an ingested event or a *ValidationError if it is not allowed.
+func (r ProviderRegistry) provider(e *model.RatingEvent) (Provider, error) {
+	if len(r) == 0 {
+		return Provider{Weight: 1}, nil
+	}
+
+	p, ok := r[e.ProviderID]
+	if !ok {
+		return Provider{}, &ValidationError{Violations: []FieldViolation{
+			{Field: "providerId", Description: fmt.Sprintf("unknown provider %q", e.ProviderID)},
+		}}
+	}
+	if len(p.RecordTypes) > 0 && !slices.Contains(p.RecordTypes, e.RecordType) {
+		return Provider{}, &ValidationError{Violations: []FieldViolation{
+			{Field: "recordType", Description: fmt.Sprintf("provider %q may not rate record type %q", e.ProviderID, e.RecordType)},
+		}}
+	}
+	return p, nil
+}
+
+// ingestedRating converts an ingested event into a rating on the scale of its record type,
+// weighted by the trust in its provider. It returns a *ValidationError if the event is not allowed.
+func (s *Controller) ingestedRating(e *model.RatingEvent) (*model.Rating, error) {
+	p, err := s.ingestion.Providers.provider(e)
+	if err != nil {
+		return nil, err
+	}
+
+	rating := &model.Rating{
+		RecordID:   e.RecordID,
+		RecordType: e.RecordType,
+		UserID:     e.UserID,
+		Value:      e.Value,
+		ProviderID: e.ProviderID,
+		Weight:     p.Weight,
+	}
+	if target, ok := s.recordTypes[e.RecordType]; ok && p.Scale != nil {
+		from := *p.Scale
+		if e.Value < from.Min || e.Value > from.Max {
+			return nil, &ValidationError{Violations: []FieldViolation{{
+				Field:       "value",
+				Description: fmt.Sprintf("must be between %d and %d for provider %q", from.Min, from.Max, e.ProviderID),
+			}}}
+		}
+		rating.Value = normalize(e.Value, from, target)
+	}
+	if err := s.recordTypes.validateRating(e.RecordID, e.RecordType, rating); err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+
+// normalize maps a rating value linearly from one scale to the closest valid value of another,
+// for example 1 to 10 onto 1 to 5.
+// The step of the target scale may not divide its range, so the value is kept within the steps that fit in it.
+func normalize(v model.RatingValue, from Scale, to Scale) model.RatingValue {
+	ratio := float64(v-from.Min) / float64(from.Max-from.Min)
+	steps := model.RatingValue(math.Round(ratio * float64(to.Max-to.Min) / float64(to.Step)))
+	steps = max(0, min(steps, (to.Max-to.Min)/to.Step))
+	return to.Min + steps*to.Step
+}
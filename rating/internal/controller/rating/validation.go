@@ -0,0 +1,81 @@
+package rating
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Scale defines the valid rating values of a record type: Min, Min+Step, ..., up to Max.
+type Scale struct {
+	Min  model.RatingValue
+	Max  model.RatingValue
+	Step model.RatingValue
+}
+
+// RecordTypeRegistry defines the known record types and their rating scales.
+type RecordTypeRegistry map[model.RecordType]Scale
+
+// DefaultRecordTypeRegistry returns a registry in which movies are rated from 1 to 5 stars.
+func DefaultRecordTypeRegistry() RecordTypeRegistry {
+	return RecordTypeRegistry{
+		model.RecordTypeMovie: {Min: 1, Max: 5, Step: 1},
+	}
+}
+
+// Validate checks that every scale of the registry is well-formed.
+func (r RecordTypeRegistry) Validate() error {
+	for recordType, s := range r {
+		if s.Min > s.Max || s.Step <= 0 {
+			return fmt.Errorf("invalid scale of record type %q: min %d, max %d, step %d", recordType, s.Min, s.Max, s.Step)
+		}
+	}
+	return nil
+}
+
+// FieldViolation describes why a field of a rating is invalid.
+type FieldViolation struct {
+	// Field is the JSON name of the field in model.Rating.
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// ValidationError is returned when a rating is invalid.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	var descriptions []string
+	for _, v := range e.Violations {
+		descriptions = append(descriptions, v.Field+": "+v.Description)
+	}
+	return "invalid rating: " + strings.Join(descriptions, "; ")
+}
+
+// validateRating checks a rating for a record against the scale of the record type.
+func (r RecordTypeRegistry) validateRating(recordID model.RecordID, recordType model.RecordType, rating *model.Rating) error {
+	var violations []FieldViolation
+	if recordID == "" {
+		violations = append(violations, FieldViolation{Field: "recordId", Description: "must not be empty"})
+	}
+	if rating.UserID == "" {
+		violations = append(violations, FieldViolation{Field: "userId", Description: "must not be empty"})
+	}
+
+	s, ok := r[recordType]
+	if !ok {
+		violations = append(violations, FieldViolation{Field: "recordType", Description: fmt.Sprintf("unknown record type %q", recordType)})
+	} else if rating.Value < s.Min || rating.Value > s.Max || (rating.Value-s.Min)%s.Step != 0 {
+		violations = append(violations, FieldViolation{
+			Field:       "value",
+			Description: fmt.Sprintf("must be between %d and %d in steps of %d", s.Min, s.Max, s.Step),
+		})
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
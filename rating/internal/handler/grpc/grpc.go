@@ -3,10 +3,12 @@ package grpc
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/akkahshh24/movieapp/gen"
 	"github.com/akkahshh24/movieapp/rating/internal/controller/rating"
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -33,13 +35,15 @@ func (h *Handler) GetAggregatedRating(ctx context.Context, req *gen.GetAggregate
 
 	// Call the controller to get the aggregated rating
 	// for the given record ID and type.
-	v, err := h.ctrl.GetAggregatedRating(ctx, model.RecordID(req.RecordId), model.RecordType(req.RecordType))
+	v, err := h.ctrl.GetAggregatedRating(ctx, model.RecordID(req.RecordId), model.RecordType(req.RecordType), req.AggregationStrategy)
 	if err != nil && errors.Is(err, rating.ErrNotFound) {
 		return nil, status.Errorf(codes.NotFound, err.Error())
+	} else if err != nil && errors.Is(err, rating.ErrUnknownStrategy) {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
 	} else if err != nil {
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
-	return &gen.GetAggregatedRatingResponse{RatingValue: v}, nil
+	return v.ToProto(), nil
 }
 
 // PutRating writes a rating for a given record.
@@ -51,8 +55,121 @@ func (h *Handler) PutRating(ctx context.Context, req *gen.PutRatingRequest) (*ge
 
 	// Call the controller to put the rating
 	// for the given record ID and type.
-	if err := h.ctrl.PutRating(ctx, model.RecordID(req.RecordId), model.RecordType(req.RecordType), &model.Rating{UserID: model.UserID(req.UserId), Value: model.RatingValue(req.RatingValue)}); err != nil {
+	created, err := h.ctrl.PutRating(ctx, model.RecordID(req.RecordId), model.RecordType(req.RecordType), &model.Rating{UserID: model.UserID(req.UserId), Value: model.RatingValue(req.RatingValue)})
+	var validationErr *rating.ValidationError
+	if err != nil && errors.As(err, &validationErr) {
+		return nil, invalidRatingStatus(validationErr)
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	return &gen.PutRatingResponse{Created: created}, nil
+}
+
+// DeleteRating removes a user's rating for a given record.
+func (h *Handler) DeleteRating(ctx context.Context, req *gen.DeleteRatingRequest) (*gen.DeleteRatingResponse, error) {
+	// Validate the request
+	if req == nil || req.RecordId == "" || req.RecordType == "" || req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty user id, record id or record type")
+	}
+
+	// Call the controller to delete the rating
+	// for the given record ID and type.
+	err := h.ctrl.DeleteRating(ctx, model.RecordID(req.RecordId), model.RecordType(req.RecordType), model.UserID(req.UserId))
+	if err != nil && errors.Is(err, rating.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	return &gen.DeleteRatingResponse{}, nil
+}
+
+// PurgeProviderRatings removes all ratings ingested from a provider.
+func (h *Handler) PurgeProviderRatings(ctx context.Context, req *gen.PurgeProviderRatingsRequest) (*gen.PurgeProviderRatingsResponse, error) {
+	// Validate the request
+	if req == nil || req.ProviderId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty provider id")
+	}
+
+	n, err := h.ctrl.PurgeProvider(ctx, req.ProviderId)
+	if err != nil {
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
-	return &gen.PutRatingResponse{}, nil
+	return &gen.PurgeProviderRatingsResponse{DeletedCount: int64(n)}, nil
+}
+
+// ListRatingHistory returns a page of the ratings of a record within a time range.
+func (h *Handler) ListRatingHistory(ctx context.Context, req *gen.ListRatingHistoryRequest) (*gen.ListRatingHistoryResponse, error) {
+	// Validate the request
+	if req == nil || req.RecordId == "" || req.RecordType == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty id/type")
+	}
+
+	// Unset bounds leave the time range open.
+	var start, end time.Time
+	if req.StartTime != nil {
+		start = req.StartTime.AsTime()
+	}
+	if req.EndTime != nil {
+		end = req.EndTime.AsTime()
+	}
+
+	ratings, nextPageToken, err := h.ctrl.ListRatingHistory(ctx, model.RecordID(req.RecordId), model.RecordType(req.RecordType), start, end, int(req.PageSize), req.PageToken)
+	if err != nil && errors.Is(err, rating.ErrInvalidPageToken) {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	res := &gen.ListRatingHistoryResponse{NextPageToken: nextPageToken}
+	for _, r := range ratings {
+		res.Ratings = append(res.Ratings, r.ToProto())
+	}
+	return res, nil
+}
+
+// ListUserRatings returns a page of the ratings of a user.
+func (h *Handler) ListUserRatings(ctx context.Context, req *gen.ListUserRatingsRequest) (*gen.ListUserRatingsResponse, error) {
+	// Validate the request
+	if req == nil || req.UserId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "nil req or empty user id")
+	}
+
+	ratings, nextPageToken, err := h.ctrl.ListUserRatings(ctx, model.UserID(req.UserId), model.RecordType(req.RecordType), req.SortBy, req.Descending, int(req.PageSize), req.PageToken)
+	if err != nil && (errors.Is(err, rating.ErrInvalidPageToken) || errors.Is(err, rating.ErrInvalidSort)) {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	res := &gen.ListUserRatingsResponse{NextPageToken: nextPageToken}
+	for _, r := range ratings {
+		res.Ratings = append(res.Ratings, r.ToProto())
+	}
+	return res, nil
+}
+
+// putRatingFields maps the rating fields reported in validation errors to the fields of PutRatingRequest.
+var putRatingFields = map[string]string{
+	"recordId":   "record_id",
+	"recordType": "record_type",
+	"userId":     "user_id",
+	"value":      "rating_value",
+}
+
+// invalidRatingStatus converts a rating validation error into an InvalidArgument status with field violations.
+func invalidRatingStatus(e *rating.ValidationError) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       putRatingFields[v.Field],
+			Description: v.Description,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, e.Error()).WithDetails(badRequest)
+	if err != nil {
+		// Fall back to a status without details, it still carries the violations in its message.
+		return status.Errorf(codes.InvalidArgument, e.Error())
+	}
+	return st.Err()
 }
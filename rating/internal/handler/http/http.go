@@ -21,7 +21,7 @@ func New(ctrl *rating.Controller) *Handler {
 	return &Handler{ctrl}
 }
 
-// Handle handles PUT and GET /rating requests.
+// Handle handles PUT, GET and DELETE /rating requests.
 func (h *Handler) Handle(w http.ResponseWriter, req *http.Request) {
 	recordID := model.RecordID(req.FormValue("id"))
 	if recordID == "" {
@@ -35,10 +35,17 @@ func (h *Handler) Handle(w http.ResponseWriter, req *http.Request) {
 	}
 	switch req.Method {
 	case http.MethodGet:
-		v, err := h.ctrl.GetAggregatedRating(req.Context(), recordID, recordType)
+		v, err := h.ctrl.GetAggregatedRating(req.Context(), recordID, recordType, req.FormValue("strategy"))
 		if err != nil && errors.Is(err, rating.ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
+		} else if err != nil && errors.Is(err, rating.ErrUnknownStrategy) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Repository get error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 		if err := json.NewEncoder(w).Encode(v); err != nil {
 			log.Printf("Response encode error: %v\n", err)
@@ -47,14 +54,37 @@ func (h *Handler) Handle(w http.ResponseWriter, req *http.Request) {
 		}
 	case http.MethodPut:
 		userID := model.UserID(req.FormValue("userId"))
-		v, err := strconv.ParseFloat(req.FormValue("value"), 64)
+		// Ratings are whole numbers, so fractional values are rejected rather than truncated.
+		v, err := strconv.Atoi(req.FormValue("value"))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if err := h.ctrl.PutRating(req.Context(), recordID, recordType, &model.Rating{UserID: userID, Value: model.RatingValue(v)}); err != nil {
+		created, err := h.ctrl.PutRating(req.Context(), recordID, recordType, &model.Rating{UserID: userID, Value: model.RatingValue(v)})
+		var validationErr *rating.ValidationError
+		if err != nil && errors.As(err, &validationErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(validationErr.Violations); err != nil {
+				log.Printf("Response encode error: %v\n", err)
+			}
+		} else if err != nil {
 			log.Printf("Repository put error: %v\n", err)
 			w.WriteHeader(http.StatusInternalServerError)
+		} else if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodDelete:
+		userID := model.UserID(req.FormValue("userId"))
+		if userID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		err := h.ctrl.DeleteRating(req.Context(), recordID, recordType, userID)
+		if err != nil && errors.Is(err, rating.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else if err != nil {
+			log.Printf("Repository delete error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
 		}
 	default:
 		w.WriteHeader(http.StatusBadRequest)
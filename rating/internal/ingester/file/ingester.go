@@ -0,0 +1,154 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Ingester defines an ingester that reads JSON-encoded rating events from a file, one per line.
+// The file is read from the start, so events are identified by their position in the file and
+// the ones that have been processed before are skipped.
+type Ingester struct {
+	path string
+	// follow makes the ingester wait for lines appended to the file instead of stopping at its end.
+	follow       bool
+	pollInterval time.Duration
+	// deadLetterPath is the file rejected events are appended to. Rejected events are dropped if it is empty.
+	deadLetterPath string
+
+	mu sync.Mutex
+}
+
+// New creates a new file ingester.
+func New(path string, follow bool, pollInterval time.Duration, deadLetterPath string) *Ingester {
+	return &Ingester{path: path, follow: follow, pollInterval: pollInterval, deadLetterPath: deadLetterPath}
+}
+
+// Publish appends rating events to the file.
+func (i *Ingester) Publish(_ context.Context, events []model.RatingEvent) error {
+	var lines []byte
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, b...), '\n')
+	}
+	return i.append(i.path, lines)
+}
+
+// Ingest starts reading rating events from the file and sends them over a channel.
+func (i *Ingester) Ingest(ctx context.Context) (chan ingester.Message, error) {
+	// Create the file if needed, so that the ingester can start before any event is written.
+	f, err := os.OpenFile(i.path, os.O_RDONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("Starting file ingester for " + i.path)
+
+	ch := make(chan ingester.Message, 1)
+	go func() {
+		defer close(ch)
+		defer f.Close()
+
+		r := bufio.NewReader(f)
+		var offset int64
+		var line []byte
+		for {
+			b, err := r.ReadBytes('\n')
+			line = append(line, b...)
+			if errors.Is(err, io.EOF) {
+				if i.follow {
+					// Wait for the rest of the file to be written.
+					select {
+					case <-time.After(i.pollInterval):
+						continue
+					case <-ctx.Done():
+						return
+					}
+				}
+				// The last line may lack a line break.
+				if len(line) == 0 {
+					return
+				}
+			} else if err != nil {
+				fmt.Println("File read error:", err)
+				return
+			}
+
+			key := fmt.Sprintf("%s/%d", i.path, offset)
+			offset += int64(len(line))
+			value := line
+			line = nil
+			if len(bytes.TrimSpace(value)) == 0 {
+				continue
+			}
+
+			event, err := model.UnmarshalRatingEvent(value, model.ContentTypeJSON, "")
+			if err != nil {
+				// Undecodable lines cannot succeed on a retry.
+				fmt.Println("Unmarshal error:", err)
+				if err := i.reject(value, err); err != nil {
+					fmt.Println("Failed to dead-letter line:", err)
+				}
+				continue
+			}
+			if k := event.Key(); k != "" {
+				key = k
+			}
+
+			select {
+			case ch <- ingester.Message{
+				Event: *event,
+				Key:   key,
+				Ack:   func(context.Context) error { return nil },
+				Reject: func(_ context.Context, cause error, _ int) error {
+					return i.reject(value, cause)
+				},
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// reject appends a line that failed to be processed to the dead-letter file.
+func (i *Ingester) reject(line []byte, cause error) error {
+	if i.deadLetterPath == "" {
+		fmt.Printf("Dropping line %q: %v\n", line, cause)
+		return nil
+	}
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	return i.append(i.deadLetterPath, line)
+}
+
+// append appends data to a file, creating it if needed.
+func (i *Ingester) append(path string, data []byte) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
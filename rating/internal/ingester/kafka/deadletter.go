@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to dead-lettered messages to describe the failure.
+const (
+	headerPrefix            = "dlq-"
+	headerError             = headerPrefix + "error"
+	headerAttempts          = headerPrefix + "attempts"
+	headerFailedAt          = headerPrefix + "failed-at"
+	headerOriginalTopic     = headerPrefix + "original-topic"
+	headerOriginalPartition = headerPrefix + "original-partition"
+	headerOriginalOffset    = headerPrefix + "original-offset"
+)
+
+// deadLetterMessage creates the dead-letter copy of a message that failed to be processed.
+func deadLetterMessage(m kafka.Message, cause error, attempts int) kafka.Message {
+	headers := append(originalHeaders(m.Headers),
+		kafka.Header{Key: headerError, Value: []byte(cause.Error())},
+		kafka.Header{Key: headerAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: headerFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		kafka.Header{Key: headerOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: headerOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: headerOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+	)
+	return kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+}
+
+// originalHeaders returns the headers of a message without the ones describing a failure.
+func originalHeaders(headers []kafka.Header) []kafka.Header {
+	var res []kafka.Header
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, headerPrefix) {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// ReplayDeadLetters moves the messages of the dead-letter topic back to the main topic.
+// It returns the number of replayed messages once no message arrived for the idle duration.
+func ReplayDeadLetters(ctx context.Context, addr string, groupID string, deadLetterTopic string, topic string, idle time.Duration) (int, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{addr},
+		GroupID:     groupID,
+		Topic:       deadLetterTopic,
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     time.Second,
+	})
+	defer reader.Close()
+
+	writer := &kafka.Writer{Addr: kafka.TCP(addr), Topic: topic, RequiredAcks: kafka.RequireAll}
+	defer writer.Close()
+
+	var n int
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			// The dead-letter topic is drained.
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return n, nil
+			}
+			return n, err
+		}
+
+		if err := writer.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Headers: originalHeaders(m.Headers)}); err != nil {
+			return n, err
+		}
+		if err := reader.CommitMessages(ctx, m); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -2,21 +2,32 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
 	"github.com/segmentio/kafka-go"
 )
 
+// A failed write to the dead-letter topic is retried with an exponential backoff.
+const (
+	deadLetterMinBackoff = 100 * time.Millisecond
+	deadLetterMaxBackoff = 5 * time.Second
+)
+
 // Ingester defines a Kafka ingester.
 type Ingester struct {
-	reader *kafka.Reader
+	reader  *kafka.Reader
+	offsets *offsetTracker
+	// deadLetter writes failed messages to the dead-letter topic. It is nil if no topic is configured.
+	deadLetter *kafka.Writer
 }
 
 // NewIngester creates a new Kafka ingester.
-func NewIngester(addr string, groupID string, topic string) (*Ingester, error) {
+// Messages that fail to be processed are moved to the dead-letter topic or, if it is empty, dropped.
+func NewIngester(addr string, groupID string, topic string, deadLetterTopic string) (*Ingester, error) {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     []string{addr},
 		GroupID:     groupID,
@@ -26,36 +37,109 @@ func NewIngester(addr string, groupID string, topic string) (*Ingester, error) {
 		StartOffset: kafka.FirstOffset,
 		MaxWait:     time.Second,
 	})
-	return &Ingester{reader: reader}, nil
+
+	var deadLetter *kafka.Writer
+	if deadLetterTopic != "" {
+		deadLetter = &kafka.Writer{Addr: kafka.TCP(addr), Topic: deadLetterTopic, RequiredAcks: kafka.RequireAll}
+	}
+	return &Ingester{reader: reader, offsets: newOffsetTracker(reader), deadLetter: deadLetter}, nil
 }
 
 // Ingest starts reading messages from Kafka and sends them over a channel.
-func (i *Ingester) Ingest(ctx context.Context) (chan model.RatingEvent, error) {
-	fmt.Println("Starting Kafka ingester")
+// Offsets are only committed when a message and all earlier ones of its partition are acknowledged,
+// so that unprocessed messages are redelivered. Messages may be acknowledged in any order.
+func (i *Ingester) Ingest(ctx context.Context) (chan ingester.Message, error) {
+	log.Println("Starting Kafka ingester")
 
-	ch := make(chan model.RatingEvent, 1)
+	ch := make(chan ingester.Message, 1)
 	go func() {
 		defer close(ch)
 		defer i.reader.Close()
+		if i.deadLetter != nil {
+			defer i.deadLetter.Close()
+		}
 
 		for {
-			m, err := i.reader.ReadMessage(ctx)
+			// Unlike ReadMessage, FetchMessage does not commit the offset of the message.
+			m, err := i.reader.FetchMessage(ctx)
 			if err != nil {
 				if ctx.Err() != nil {
 					return
 				}
-				fmt.Println("Kafka read error:", err)
+				log.Println("Kafka read error:", err)
 				continue
 			}
+			tm := i.offsets.add(m)
 
-			var event model.RatingEvent
-			if err := json.Unmarshal(m.Value, &event); err != nil {
-				fmt.Println("Unmarshal error:", err)
+			event, err := model.UnmarshalRatingEvent(m.Value, header(m, model.HeaderContentType), header(m, model.HeaderSchemaVersion))
+			if err != nil {
+				// Undecodable messages cannot succeed on a retry.
+				log.Println("Unmarshal error:", err)
+				// The offsets cannot move past the message until it is dead-lettered.
+				for backoff := deadLetterMinBackoff; ; backoff = min(2*backoff, deadLetterMaxBackoff) {
+					rejectErr := i.reject(ctx, tm, err, 1)
+					if rejectErr == nil || ctx.Err() != nil {
+						break
+					}
+					log.Printf("Failed to dead-letter message, retrying in %v: %v", backoff, rejectErr)
+					select {
+					case <-time.After(backoff):
+					case <-ctx.Done():
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
 				continue
 			}
-			ch <- event
+
+			// Fall back to the position of the message in the topic for events without an id.
+			key := event.Key()
+			if key == "" {
+				key = fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset)
+			}
+
+			select {
+			case ch <- ingester.Message{
+				Event: *event,
+				Key:   key,
+				Ack: func(ctx context.Context) error {
+					return i.offsets.commit(ctx, tm)
+				},
+				Reject: func(ctx context.Context, cause error, attempts int) error {
+					return i.reject(ctx, tm, cause, attempts)
+				},
+			}:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
 	return ch, nil
 }
+
+// reject moves a message to the dead-letter topic and commits it.
+// It may be called again after a failure, in which case a message already dead-lettered is only committed.
+func (i *Ingester) reject(ctx context.Context, tm *trackedMessage, cause error, attempts int) error {
+	m := tm.msg
+	if i.deadLetter != nil && !tm.deadLettered {
+		if err := i.deadLetter.WriteMessages(ctx, deadLetterMessage(m, cause, attempts)); err != nil {
+			return err
+		}
+		tm.deadLettered = true
+	} else if i.deadLetter == nil {
+		log.Printf("Dropping message %s/%d/%d: %v\n", m.Topic, m.Partition, m.Offset, cause)
+	}
+	return i.offsets.commit(ctx, tm)
+}
+
+// header returns the value of a message header or an empty string if it is missing.
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker commits the offsets of messages that are acknowledged out of order.
+// Committing an offset implicitly commits all earlier ones of the partition, so an offset
+// is only committed once all earlier messages of its partition have been acknowledged.
+type offsetTracker struct {
+	mu     sync.Mutex
+	reader *kafka.Reader
+	// pending holds the fetched messages of every partition that are not committed yet, in offset order.
+	pending map[int][]*trackedMessage
+}
+
+type trackedMessage struct {
+	msg  kafka.Message
+	done bool
+	// deadLettered is set once the message has been written to the dead-letter topic.
+	deadLettered bool
+}
+
+func newOffsetTracker(reader *kafka.Reader) *offsetTracker {
+	return &offsetTracker{reader: reader, pending: map[int][]*trackedMessage{}}
+}
+
+// add registers a fetched message. Messages must be added in the order they are fetched.
+func (t *offsetTracker) add(m kafka.Message) *trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tm := &trackedMessage{msg: m}
+	t.pending[m.Partition] = append(t.pending[m.Partition], tm)
+	return tm
+}
+
+// commit marks a message as processed and commits the longest processed prefix of its partition.
+func (t *offsetTracker) commit(ctx context.Context, tm *trackedMessage) error {
+	// The lock is held while committing, so that commits of a partition never go backwards.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tm.done = true
+	pending := t.pending[tm.msg.Partition]
+	var n int
+	for n < len(pending) && pending[n].done {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	if err := t.reader.CommitMessages(ctx, pending[n-1].msg); err != nil {
+		return err
+	}
+	t.pending[tm.msg.Partition] = pending[n:]
+	return nil
+}
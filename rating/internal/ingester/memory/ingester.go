@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/akkahshh24/movieapp/rating/internal/ingester"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Ingester defines an in-process, channel-based ingester.
+// Rating events published to it are ingested by the same process.
+type Ingester struct {
+	ch chan model.RatingEvent
+
+	mu       sync.Mutex
+	seq      int
+	rejected []model.RatingEvent
+}
+
+// New creates a new in-memory ingester that buffers up to size published events.
+func New(size int) *Ingester {
+	return &Ingester{ch: make(chan model.RatingEvent, size)}
+}
+
+// Publish sends rating events to the ingester.
+func (i *Ingester) Publish(ctx context.Context, events []model.RatingEvent) error {
+	for _, e := range events {
+		select {
+		case i.ch <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close ends the ingestion once all published events have been ingested.
+func (i *Ingester) Close() {
+	close(i.ch)
+}
+
+// Rejected returns the events that failed to be processed.
+func (i *Ingester) Rejected() []model.RatingEvent {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]model.RatingEvent(nil), i.rejected...)
+}
+
+// Ingest starts sending the published rating events over a channel.
+// Acknowledgements are no-ops, as events are not redelivered.
+func (i *Ingester) Ingest(ctx context.Context) (chan ingester.Message, error) {
+	ch := make(chan ingester.Message, 1)
+	go func() {
+		defer close(ch)
+		for {
+			var e model.RatingEvent
+			select {
+			case ev, ok := <-i.ch:
+				if !ok {
+					return
+				}
+				e = ev
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case ch <- i.message(e):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (i *Ingester) message(e model.RatingEvent) ingester.Message {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// Fall back to the position of the event for events without an id.
+	i.seq++
+	key := e.Key()
+	if key == "" {
+		key = fmt.Sprintf("memory/%d", i.seq)
+	}
+	return ingester.Message{
+		Event: e,
+		Key:   key,
+		Ack:   func(context.Context) error { return nil },
+		Reject: func(_ context.Context, cause error, attempts int) error {
+			fmt.Printf("Rejected event %s after %d attempts: %v\n", key, attempts, cause)
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			i.rejected = append(i.rejected, e)
+			return nil
+		},
+	}
+}
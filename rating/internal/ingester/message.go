@@ -0,0 +1,20 @@
+package ingester
+
+import (
+	"context"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Message defines a consumed rating event.
+type Message struct {
+	Event model.RatingEvent
+	// Key uniquely identifies the event, so that a redelivered event can be recognized.
+	Key string
+	// Ack acknowledges that the event has been processed, so that it is not delivered again.
+	// Unacknowledged events are redelivered after a restart.
+	Ack func(ctx context.Context) error
+	// Reject moves an event that failed to be processed to the dead-letter queue along with
+	// the cause of the failure and acknowledges it.
+	Reject func(ctx context.Context, cause error, attempts int) error
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher defines a Kafka rating event publisher.
+type Publisher struct {
+	writer      *kafka.Writer
+	contentType string
+}
+
+// NewPublisher creates a publisher that encodes rating events with the given content type.
+func NewPublisher(addr string, topic string, contentType string) *Publisher {
+	return &Publisher{
+		writer:      &kafka.Writer{Addr: kafka.TCP(addr), Topic: topic, RequiredAcks: kafka.RequireAll},
+		contentType: contentType,
+	}
+}
+
+// Publish writes rating events to Kafka.
+// Events are keyed by record, so that the events of a record keep their order.
+func (p *Publisher) Publish(ctx context.Context, events []model.RatingEvent) error {
+	msgs := make([]kafka.Message, len(events))
+	for i := range events {
+		value, err := model.MarshalRatingEvent(&events[i], p.contentType)
+		if err != nil {
+			return err
+		}
+		msgs[i] = kafka.Message{
+			Key:   []byte(string(events[i].RecordType) + "/" + string(events[i].RecordID)),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: model.HeaderContentType, Value: []byte(p.contentType)},
+				{Key: model.HeaderSchemaVersion, Value: []byte(model.RatingEventSchemaVersion)},
+			},
+		}
+	}
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
+// Close flushes pending writes and closes the publisher.
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// Publisher defines an in-memory rating event publisher.
+type Publisher struct {
+	sync.RWMutex
+	events []model.RatingEvent
+}
+
+// New creates a new in-memory publisher.
+func New() *Publisher {
+	return &Publisher{}
+}
+
+// Publish records rating events.
+func (p *Publisher) Publish(_ context.Context, events []model.RatingEvent) error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.events = append(p.events, events...)
+	return nil
+}
+
+// Events returns the published rating events in the order they were published.
+func (p *Publisher) Events() []model.RatingEvent {
+	p.RLock()
+	defer p.RUnlock()
+
+	return append([]model.RatingEvent(nil), p.events...)
+}
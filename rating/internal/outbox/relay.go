@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/internal/repository"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+type outboxRepository interface {
+	ListOutbox(ctx context.Context, limit int) ([]repository.OutboxEntry, error)
+	DeleteOutbox(ctx context.Context, ids []int64) error
+	MarkEventsProcessed(ctx context.Context, keys []string) error
+}
+
+type eventPublisher interface {
+	Publish(ctx context.Context, events []model.RatingEvent) error
+}
+
+// Relay publishes the rating events written to the outbox.
+// Events are deleted from the outbox only after they have been published, so an event may be
+// published more than once. Consumers recognize such events by their id. Events are marked as
+// processed before they are published, so that the service skips them when it ingests them back.
+type Relay struct {
+	repo       outboxRepository
+	publisher  eventPublisher
+	providerID string
+	interval   time.Duration
+	batchSize  int
+}
+
+// NewRelay creates a relay that publishes events on behalf of the given provider,
+// checking the outbox for new events at the given interval.
+func NewRelay(repo outboxRepository, publisher eventPublisher, providerID string, interval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		repo:       repo,
+		publisher:  publisher,
+		providerID: providerID,
+		interval:   interval,
+		batchSize:  max(batchSize, 1),
+	}
+}
+
+// Start publishes the events of the outbox until the context is canceled.
+func (r *Relay) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Relay(ctx); err != nil {
+			log.Println("Failed to relay rating events: " + err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Relay publishes all events currently in the outbox and returns how many were published.
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	var n int
+	for {
+		entries, err := r.repo.ListOutbox(ctx, r.batchSize)
+		if err != nil || len(entries) == 0 {
+			return n, err
+		}
+
+		events := make([]model.RatingEvent, len(entries))
+		ids := make([]int64, len(entries))
+		keys := make([]string, len(entries))
+		for i, e := range entries {
+			events[i] = e.Event
+			events[i].ProviderID = r.providerID
+			ids[i] = e.ID
+			keys[i] = events[i].Key()
+		}
+
+		if err := r.repo.MarkEventsProcessed(ctx, keys); err != nil {
+			return n, err
+		}
+		if err := r.publisher.Publish(ctx, events); err != nil {
+			return n, err
+		}
+		if err := r.repo.DeleteOutbox(ctx, ids); err != nil {
+			return n, err
+		}
+		n += len(entries)
+
+		if len(entries) < r.batchSize {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cachememory "github.com/akkahshh24/movieapp/rating/internal/cache/memory"
+	"github.com/akkahshh24/movieapp/rating/internal/controller/rating"
+	"github.com/akkahshh24/movieapp/rating/internal/outbox/memory"
+	repomemory "github.com/akkahshh24/movieapp/rating/internal/repository/memory"
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	repo := repomemory.New()
+	ctrl := rating.New(repo, cachememory.New(0, 0), nil, rating.DefaultAggregation(), rating.DefaultRecordTypeRegistry(), rating.DefaultIngestionConfig(), 0)
+	publisher := memory.New()
+	relay := NewRelay(repo, publisher, "rating", time.Second, 2)
+
+	_, err := ctrl.PutRating(ctx, "1", model.RecordTypeMovie, &model.Rating{UserID: "alice", Value: 5})
+	assert.NoError(t, err)
+	_, err = ctrl.PutRating(ctx, "1", model.RecordTypeMovie, &model.Rating{UserID: "bob", Value: 3})
+	assert.NoError(t, err)
+	assert.NoError(t, ctrl.DeleteRating(ctx, "1", model.RecordTypeMovie, "alice"))
+
+	n, err := relay.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	events := publisher.Events()
+	if assert.Len(t, events, 3) {
+		for i, want := range []struct {
+			userID    model.UserID
+			eventType model.RatingEventType
+		}{
+			{"alice", model.RatingEventTypePut},
+			{"bob", model.RatingEventTypePut},
+			{"alice", model.RatingEventTypeDelete},
+		} {
+			assert.Equal(t, want.userID, events[i].UserID)
+			assert.Equal(t, want.eventType, events[i].EventType)
+			assert.Equal(t, "rating", events[i].ProviderID)
+			assert.NotEmpty(t, events[i].EventID)
+		}
+	}
+
+	// Published events are removed from the outbox.
+	n, err = relay.Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Published events are skipped when they are ingested back.
+	processed, err := repo.ProcessedEvents(ctx, []string{events[0].Key()})
+	assert.NoError(t, err)
+	assert.True(t, processed[events[0].Key()])
+}
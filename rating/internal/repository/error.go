@@ -4,3 +4,13 @@ import "errors"
 
 // ErrNotFound is returned when a requested record is not found.
 var ErrNotFound = errors.New("not found")
+
+// ErrNotOwned is returned when a provider changes a rating made through the API or ingested from another provider.
+var ErrNotOwned = errors.New("rating owned by another provider")
+
+// CanChange reports whether a rating stored by owner may be changed by a given provider.
+// Changes made through the API, whose provider is empty, apply to any rating, while a provider
+// may only change the ratings ingested from it.
+func CanChange(providerID, owner string) bool {
+	return providerID == "" || providerID == owner
+}
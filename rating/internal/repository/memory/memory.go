@@ -1,7 +1,13 @@
 package memory
 
 import (
+	"cmp"
 	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/akkahshh24/movieapp/rating/internal/repository"
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
@@ -9,17 +15,30 @@ import (
 
 // Repository defines a rating repository.
 type Repository struct {
+	sync.RWMutex
 	data map[model.RecordType]map[model.RecordID][]model.Rating
 	// For example, {movie: {movie_id: {4, 5, 5}}}
+	aggregates map[model.RecordType]map[model.RecordID]*model.AggregatedRating
+	// processed holds the keys of the ingested events along with when they were processed.
+	processed map[string]time.Time
+	outbox    []repository.OutboxEntry
+	outboxID  int64
 }
 
 // New creates a new memory repository.
 func New() *Repository {
-	return &Repository{map[model.RecordType]map[model.RecordID][]model.Rating{}}
+	return &Repository{
+		data:       map[model.RecordType]map[model.RecordID][]model.Rating{},
+		aggregates: map[model.RecordType]map[model.RecordID]*model.AggregatedRating{},
+		processed:  map[string]time.Time{},
+	}
 }
 
 // Get retrieves all ratings for a given record.
 func (r *Repository) Get(_ context.Context, recordID model.RecordID, recordType model.RecordType) ([]model.Rating, error) {
+	r.RLock()
+	defer r.RUnlock()
+
 	// Check if the record type exists in the repository.
 	if _, ok := r.data[recordType]; !ok {
 		return nil, repository.ErrNotFound
@@ -29,17 +48,374 @@ func (r *Repository) Get(_ context.Context, recordID model.RecordID, recordType
 	if ratings, ok := r.data[recordType][recordID]; !ok || len(ratings) == 0 {
 		return nil, repository.ErrNotFound
 	}
-	return r.data[recordType][recordID], nil
+	// Return a copy so that callers are not affected by later writes.
+	return append([]model.Rating(nil), r.data[recordType][recordID]...), nil
+}
+
+// ListHistory retrieves a page of the ratings of a given record ordered by update time and user id.
+func (r *Repository) ListHistory(_ context.Context, recordID model.RecordID, recordType model.RecordType, query repository.HistoryQuery) ([]model.Rating, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	var res []model.Rating
+	for _, rating := range r.data[recordType][recordID] {
+		if !query.Start.IsZero() && rating.UpdatedAt.Before(query.Start) {
+			continue
+		}
+		if !query.End.IsZero() && !rating.UpdatedAt.Before(query.End) {
+			continue
+		}
+		if query.After != nil && compareHistory(rating, query.After) <= 0 {
+			continue
+		}
+		res = append(res, rating)
+	}
+
+	slices.SortFunc(res, func(a, b model.Rating) int {
+		return compareHistory(a, &repository.HistoryCursor{UpdatedAt: b.UpdatedAt, UserID: b.UserID})
+	})
+	if len(res) > query.Limit {
+		res = res[:query.Limit]
+	}
+	return res, nil
+}
+
+// ListByUser retrieves a page of the ratings of a given user.
+func (r *Repository) ListByUser(_ context.Context, userID model.UserID, query repository.UserRatingsQuery) ([]model.Rating, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	// Compare ratings in the requested direction.
+	compare := func(rating model.Rating, cursor *repository.UserRatingsCursor) int {
+		c := compareUserRatings(rating, cursor, query.SortBy)
+		if query.Descending {
+			return -c
+		}
+		return c
+	}
+
+	var res []model.Rating
+	for recordType, records := range r.data {
+		if query.RecordType != "" && recordType != query.RecordType {
+			continue
+		}
+		for _, ratings := range records {
+			for _, rating := range ratings {
+				if rating.UserID != userID {
+					continue
+				}
+				if query.After != nil && compare(rating, query.After) <= 0 {
+					continue
+				}
+				res = append(res, rating)
+			}
+		}
+	}
+
+	slices.SortFunc(res, func(a, b model.Rating) int {
+		return compare(a, &repository.UserRatingsCursor{Value: b.Value, UpdatedAt: b.UpdatedAt, RecordType: b.RecordType, RecordID: b.RecordID})
+	})
+	if len(res) > query.Limit {
+		res = res[:query.Limit]
+	}
+	return res, nil
+}
+
+// GetAggregate retrieves the running aggregate of the ratings for a given record.
+func (r *Repository) GetAggregate(_ context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	a, ok := r.aggregates[recordType][recordID]
+	if !ok || a.Count == 0 {
+		return nil, repository.ErrNotFound
+	}
+
+	// Return a copy so that callers are not affected by later writes.
+	res := *a
+	res.Histogram = maps.Clone(a.Histogram)
+	return &res, nil
 }
 
-// Put adds a rating for a given record.
-func (r *Repository) Put(_ context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating) error {
+// GetTypeAggregate retrieves the running aggregate of the ratings of all records of a given type.
+// The histogram is not populated, as it is not needed for type-wide statistics.
+func (r *Repository) GetTypeAggregate(_ context.Context, recordType model.RecordType) (*model.AggregatedRating, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	res := &model.AggregatedRating{}
+	for _, a := range r.aggregates[recordType] {
+		res.Count += a.Count
+		res.Sum += a.Sum
+		res.Weight += a.Weight
+		res.WeightedSum += a.WeightedSum
+	}
+	if res.Count == 0 {
+		return nil, repository.ErrNotFound
+	}
+	res.Value = float64(res.Sum) / float64(res.Count)
+	if res.Weight > 0 {
+		res.Value = res.WeightedSum / res.Weight
+	}
+	return res, nil
+}
+
+// Put adds or replaces a user's rating for a given record.
+// It returns the replaced rating or nil if the user had not rated the record before.
+// It returns repository.ErrNotOwned if the provider of the rating may not replace the previous one.
+// If event is not nil, it is written to the outbox along with the rating.
+// If processedKey is not empty, the ingested event with that key is marked as processed along with the rating.
+func (r *Repository) Put(_ context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating, event *model.RatingEvent, processedKey string) (*model.Rating, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if prev := r.find(recordID, recordType, rating.UserID); prev != nil && !repository.CanChange(rating.ProviderID, prev.ProviderID) {
+		return nil, repository.ErrNotOwned
+	}
+	prev := r.put(recordID, recordType, rating)
+	r.addToOutbox(event)
+	r.markProcessed(processedKey)
+	return prev, nil
+}
+
+// PutBatch adds or replaces the ratings of users for the records set in the ratings and marks the ingested
+// events with the given keys as processed. It stores none of them and returns repository.ErrNotOwned if
+// the provider of a rating may not replace the previous one.
+func (r *Repository) PutBatch(_ context.Context, ratings []model.Rating, processedKeys []string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	// The owners change along the batch, as a rating may replace an earlier one of the same batch.
+	owners := map[ratingKey]string{}
+	for _, rating := range ratings {
+		key := ratingKey{rating.RecordID, rating.RecordType, rating.UserID}
+		owner, ok := owners[key]
+		if !ok {
+			if prev := r.find(rating.RecordID, rating.RecordType, rating.UserID); prev != nil {
+				owner, ok = prev.ProviderID, true
+			}
+		}
+		if ok && !repository.CanChange(rating.ProviderID, owner) {
+			return repository.ErrNotOwned
+		}
+		owners[key] = rating.ProviderID
+	}
+
+	for i := range ratings {
+		r.put(ratings[i].RecordID, ratings[i].RecordType, &ratings[i])
+	}
+	r.markProcessed(processedKeys...)
+	return nil
+}
+
+// ratingKey identifies the rating of a user for a record.
+type ratingKey struct {
+	recordID   model.RecordID
+	recordType model.RecordType
+	userID     model.UserID
+}
+
+// find returns a user's rating for a given record or nil if the user has not rated it.
+// The caller must hold the lock.
+func (r *Repository) find(recordID model.RecordID, recordType model.RecordType, userID model.UserID) *model.Rating {
+	for _, rating := range r.data[recordType][recordID] {
+		if rating.UserID == userID {
+			return &rating
+		}
+	}
+	return nil
+}
+
+// put adds or replaces a user's rating for a given record and returns the replaced one.
+// The caller must hold the write lock.
+func (r *Repository) put(recordID model.RecordID, recordType model.RecordType, rating *model.Rating) *model.Rating {
 	// Initialize the record type map if it doesn't exist.
 	if _, ok := r.data[recordType]; !ok {
 		r.data[recordType] = map[model.RecordID][]model.Rating{}
 	}
 
-	// Initialize the record ID slice if it doesn't exist.
-	r.data[recordType][recordID] = append(r.data[recordType][recordID], *rating)
+	now := time.Now()
+	stored := *rating
+	stored.RecordID, stored.RecordType, stored.CreatedAt, stored.UpdatedAt = recordID, recordType, now, now
+
+	// Replace the previous rating of the user, so that only the latest one counts.
+	ratings := r.data[recordType][recordID]
+	for i := range ratings {
+		if ratings[i].UserID == rating.UserID {
+			prev := ratings[i]
+			stored.CreatedAt = prev.CreatedAt
+			ratings[i] = stored
+			r.aggregate(recordID, recordType).Remove(prev.Value, prev.Weight)
+			r.aggregate(recordID, recordType).Add(rating.Value, rating.Weight)
+			return &prev
+		}
+	}
+
+	r.data[recordType][recordID] = append(ratings, stored)
+	r.aggregate(recordID, recordType).Add(rating.Value, rating.Weight)
+	return nil
+}
+
+// Delete removes a user's rating for a given record on behalf of a provider and returns it.
+// It returns repository.ErrNotOwned if the provider may not remove the rating.
+// If event is not nil, it is written to the outbox along with the removal.
+// If processedKey is not empty, the ingested event with that key is marked as processed along with the removal.
+func (r *Repository) Delete(_ context.Context, recordID model.RecordID, recordType model.RecordType, userID model.UserID, providerID string, event *model.RatingEvent, processedKey string) (*model.Rating, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	ratings := r.data[recordType][recordID]
+	for i, rating := range ratings {
+		if rating.UserID == userID {
+			if !repository.CanChange(providerID, rating.ProviderID) {
+				return nil, repository.ErrNotOwned
+			}
+			r.data[recordType][recordID] = append(ratings[:i], ratings[i+1:]...)
+			r.aggregate(recordID, recordType).Remove(rating.Value, rating.Weight)
+			r.addToOutbox(event)
+			r.markProcessed(processedKey)
+			return &rating, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+// ProcessedEvents returns which of the ingested events with the given keys have been processed.
+func (r *Repository) ProcessedEvents(_ context.Context, keys []string) (map[string]bool, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	res := map[string]bool{}
+	for _, key := range keys {
+		if _, ok := r.processed[key]; ok {
+			res[key] = true
+		}
+	}
+	return res, nil
+}
+
+// MarkEventsProcessed records that the ingested events with the given keys have been processed.
+func (r *Repository) MarkEventsProcessed(_ context.Context, keys []string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.markProcessed(keys...)
+	return nil
+}
+
+// PruneProcessedEvents forgets the ingested events processed before a given time and returns how many were forgotten.
+func (r *Repository) PruneProcessedEvents(_ context.Context, before time.Time) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var n int64
+	maps.DeleteFunc(r.processed, func(_ string, processedAt time.Time) bool {
+		if processedAt.Before(before) {
+			n++
+			return true
+		}
+		return false
+	})
+	return n, nil
+}
+
+// markProcessed records that the ingested events with the given non-empty keys have been processed.
+// The caller must hold the write lock.
+func (r *Repository) markProcessed(keys ...string) {
+	now := time.Now()
+	for _, key := range keys {
+		if key != "" {
+			r.processed[key] = now
+		}
+	}
+}
+
+// DeleteByProvider removes all ratings ingested from a given provider and returns them.
+// The event returned by newEvent for each removed rating is written to the outbox along with the removal.
+// newEvent is called before the removals are visible to readers.
+func (r *Repository) DeleteByProvider(_ context.Context, providerID string, newEvent func(model.Rating) *model.RatingEvent) ([]model.Rating, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var res []model.Rating
+	for recordType, records := range r.data {
+		for recordID, ratings := range records {
+			records[recordID] = slices.DeleteFunc(ratings, func(rating model.Rating) bool {
+				if rating.ProviderID != providerID {
+					return false
+				}
+				r.aggregate(recordID, recordType).Remove(rating.Value, rating.Weight)
+				r.addToOutbox(newEvent(rating))
+				res = append(res, rating)
+				return true
+			})
+		}
+	}
+	return res, nil
+}
+
+// ListOutbox retrieves the oldest rating events of the outbox.
+func (r *Repository) ListOutbox(_ context.Context, limit int) ([]repository.OutboxEntry, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	return slices.Clone(r.outbox[:min(limit, len(r.outbox))]), nil
+}
+
+// DeleteOutbox removes published rating events from the outbox.
+func (r *Repository) DeleteOutbox(_ context.Context, ids []int64) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.outbox = slices.DeleteFunc(r.outbox, func(e repository.OutboxEntry) bool {
+		return slices.Contains(ids, e.ID)
+	})
 	return nil
 }
+
+// addToOutbox writes a rating event to the outbox unless it is nil.
+// The caller must hold the write lock.
+func (r *Repository) addToOutbox(event *model.RatingEvent) {
+	if event == nil {
+		return
+	}
+	r.outboxID++
+	r.outbox = append(r.outbox, repository.OutboxEntry{ID: r.outboxID, Event: *event})
+}
+
+// aggregate returns the running aggregate of a record, creating it if needed.
+// The caller must hold the write lock.
+func (r *Repository) aggregate(recordID model.RecordID, recordType model.RecordType) *model.AggregatedRating {
+	if _, ok := r.aggregates[recordType]; !ok {
+		r.aggregates[recordType] = map[model.RecordID]*model.AggregatedRating{}
+	}
+	if _, ok := r.aggregates[recordType][recordID]; !ok {
+		r.aggregates[recordType][recordID] = &model.AggregatedRating{}
+	}
+	return r.aggregates[recordType][recordID]
+}
+
+// compareHistory compares the position of a rating in the rating history with a cursor.
+func compareHistory(rating model.Rating, cursor *repository.HistoryCursor) int {
+	if c := rating.UpdatedAt.Compare(cursor.UpdatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(string(rating.UserID), string(cursor.UserID))
+}
+
+// compareUserRatings compares the position of a rating among the ratings of a user with a cursor.
+func compareUserRatings(rating model.Rating, cursor *repository.UserRatingsCursor, sortBy repository.RatingSort) int {
+	var c int
+	if sortBy == repository.RatingSortValue {
+		c = cmp.Compare(rating.Value, cursor.Value)
+	} else {
+		c = rating.UpdatedAt.Compare(cursor.UpdatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	if c := strings.Compare(string(rating.RecordType), string(cursor.RecordType)); c != 0 {
+		return c
+	}
+	return strings.Compare(string(rating.RecordID), string(cursor.RecordID))
+}
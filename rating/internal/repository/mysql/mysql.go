@@ -3,7 +3,12 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/akkahshh24/movieapp/rating/internal/repository"
 	"github.com/akkahshh24/movieapp/rating/pkg/model"
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -24,34 +29,624 @@ func New(dsn string) (*Repository, error) {
 
 // Get retrieves all ratings for a given record.
 func (r *Repository) Get(ctx context.Context, recordID model.RecordID, recordType model.RecordType) ([]model.Rating, error) {
-	rows, err := r.db.QueryContext(ctx, "SELECT user_id, value FROM ratings WHERE record_id = ? AND record_type = ?", recordID, recordType)
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id, value, provider_id, weight, created_at, updated_at FROM ratings WHERE record_id = ? AND record_type = ?", recordID, recordType)
 	if err != nil {
 		return nil, err
 	}
 	// Ensure rows are closed after processing.
 	defer rows.Close()
 
+	res, err := scanRatings(rows, recordID, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Match the memory repository, which reports records without ratings as not found.
+	if len(res) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return res, nil
+}
+
+// ListHistory retrieves a page of the ratings of a given record ordered by update time and user id.
+func (r *Repository) ListHistory(ctx context.Context, recordID model.RecordID, recordType model.RecordType, query repository.HistoryQuery) ([]model.Rating, error) {
+	q := "SELECT user_id, value, provider_id, weight, created_at, updated_at FROM ratings WHERE record_id = ? AND record_type = ?"
+	args := []any{recordID, recordType}
+	if !query.Start.IsZero() {
+		q += " AND updated_at >= ?"
+		args = append(args, query.Start)
+	}
+	if !query.End.IsZero() {
+		q += " AND updated_at < ?"
+		args = append(args, query.End)
+	}
+	if query.After != nil {
+		q += " AND (updated_at, user_id) > (?, ?)"
+		args = append(args, query.After.UpdatedAt, query.After.UserID)
+	}
+	q += " ORDER BY updated_at, user_id LIMIT ?"
+	args = append(args, query.Limit)
+
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRatings(rows, recordID, recordType)
+}
+
+// ListByUser retrieves a page of the ratings of a given user.
+func (r *Repository) ListByUser(ctx context.Context, userID model.UserID, query repository.UserRatingsQuery) ([]model.Rating, error) {
+	sortColumn := "updated_at"
+	if query.SortBy == repository.RatingSortValue {
+		sortColumn = "value"
+	}
+	op, direction := ">", "ASC"
+	if query.Descending {
+		op, direction = "<", "DESC"
+	}
+
+	q := "SELECT record_id, record_type, value, provider_id, weight, created_at, updated_at FROM ratings WHERE user_id = ?"
+	args := []any{userID}
+	if query.RecordType != "" {
+		q += " AND record_type = ?"
+		args = append(args, query.RecordType)
+	}
+	if query.After != nil {
+		var sortValue any = query.After.UpdatedAt
+		if query.SortBy == repository.RatingSortValue {
+			sortValue = query.After.Value
+		}
+		q += fmt.Sprintf(" AND (%s, record_type, record_id) %s (?, ?, ?)", sortColumn, op)
+		args = append(args, sortValue, query.After.RecordType, query.After.RecordID)
+	}
+	q += fmt.Sprintf(" ORDER BY %[1]s %[2]s, record_type %[2]s, record_id %[2]s LIMIT ?", sortColumn, direction)
+	args = append(args, query.Limit)
+
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []model.Rating
+	for rows.Next() {
+		var recordID, recordType, providerID string
+		var value int32
+		var weight float64
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&recordID, &recordType, &value, &providerID, &weight, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, model.Rating{
+			RecordID:   model.RecordID(recordID),
+			RecordType: model.RecordType(recordType),
+			UserID:     userID,
+			Value:      model.RatingValue(value),
+			ProviderID: providerID,
+			Weight:     weight,
+			CreatedAt:  createdAt,
+			UpdatedAt:  updatedAt,
+		})
+	}
+	return res, rows.Err()
+}
+
+// GetAggregate retrieves the running aggregate of the ratings for a given record.
+func (r *Repository) GetAggregate(ctx context.Context, recordID model.RecordID, recordType model.RecordType) (*model.AggregatedRating, error) {
+	res := &model.AggregatedRating{Histogram: map[model.RatingValue]int64{}}
+	row := r.db.QueryRowContext(ctx, "SELECT rating_count, rating_sum, weight_total, weighted_sum FROM rating_aggregates WHERE record_id = ? AND record_type = ?", recordID, recordType)
+	if err := row.Scan(&res.Count, &res.Sum, &res.Weight, &res.WeightedSum); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	if res.Count == 0 {
+		return nil, repository.ErrNotFound
+	}
+	res.Value = float64(res.Sum) / float64(res.Count)
+	if res.Weight > 0 {
+		res.Value = res.WeightedSum / res.Weight
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT value, rating_count FROM rating_histograms WHERE record_id = ? AND record_type = ? AND rating_count > 0", recordID, recordType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value int32
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, err
+		}
+		res.Histogram[model.RatingValue(value)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetTypeAggregate retrieves the running aggregate of the ratings of all records of a given type.
+// The histogram is not populated, as it is not needed for type-wide statistics.
+func (r *Repository) GetTypeAggregate(ctx context.Context, recordType model.RecordType) (*model.AggregatedRating, error) {
+	res := &model.AggregatedRating{}
+	row := r.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(rating_count), 0), COALESCE(SUM(rating_sum), 0), COALESCE(SUM(weight_total), 0), COALESCE(SUM(weighted_sum), 0) FROM rating_aggregates WHERE record_type = ?", recordType)
+	if err := row.Scan(&res.Count, &res.Sum, &res.Weight, &res.WeightedSum); err != nil {
+		return nil, err
+	}
+	if res.Count == 0 {
+		return nil, repository.ErrNotFound
+	}
+	res.Value = float64(res.Sum) / float64(res.Count)
+	if res.Weight > 0 {
+		res.Value = res.WeightedSum / res.Weight
+	}
+	return res, nil
+}
+
+// Put adds or replaces a user's rating for a given record.
+// It returns the replaced rating or nil if the user had not rated the record before.
+// It returns repository.ErrNotOwned if the provider of the rating may not replace the previous one.
+// The running aggregate of the record, the outbox if event is not nil, and the processed events if processedKey
+// is not empty, are updated in the same transaction.
+func (r *Repository) Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating, event *model.RatingEvent, processedKey string) (*model.Rating, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction is committed.
+	defer tx.Rollback()
+
+	prev, err := lockRating(ctx, tx, recordID, recordType, rating.UserID)
+	if err != nil && err != repository.ErrNotFound {
+		return nil, err
+	}
+	if prev != nil && !repository.CanChange(rating.ProviderID, prev.ProviderID) {
+		return nil, repository.ErrNotOwned
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO ratings (record_id, record_type, user_id, value, provider_id, weight) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE "+upsertColumns,
+		recordID, recordType, rating.UserID, rating.Value, rating.ProviderID, rating.Weight); err != nil {
+		return nil, err
+	}
+
+	if prev != nil {
+		if err := updateAggregate(ctx, tx, recordID, recordType, prev.Value, prev.Weight, -1); err != nil {
+			return nil, err
+		}
+	}
+	if err := updateAggregate(ctx, tx, recordID, recordType, rating.Value, rating.Weight, 1); err != nil {
+		return nil, err
+	}
+	if err := addToOutbox(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := markProcessed(ctx, tx, processedKey); err != nil {
+		return nil, err
+	}
+	return prev, tx.Commit()
+}
+
+// upsertColumns updates the columns of an existing rating with the values of an inserted one.
+const upsertColumns = "value = VALUES(value), provider_id = VALUES(provider_id), weight = VALUES(weight), updated_at = CURRENT_TIMESTAMP"
+
+// maxBatchRows is the number of rows written by a single statement of a batch,
+// which keeps statements well below the placeholder limit of MySQL.
+const maxBatchRows = 1000
+
+// PutBatch adds or replaces the ratings of users for the records set in the ratings and marks the ingested
+// events with the given keys as processed. It stores none of them and returns repository.ErrNotOwned if
+// the provider of a rating may not replace the previous one.
+// The running aggregates of the touched records are recomputed once in the same transaction.
+func (r *Repository) PutBatch(ctx context.Context, ratings []model.Rating, processedKeys []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	owners, err := lockOwners(ctx, tx, ratings)
+	if err != nil {
+		return err
+	}
+	// The owners change along the batch, as a rating may replace an earlier one of the same batch.
+	for _, rating := range ratings {
+		key := ratingKey{rating.RecordID, rating.RecordType, rating.UserID}
+		if owner, ok := owners[key]; ok && !repository.CanChange(rating.ProviderID, owner) {
+			return repository.ErrNotOwned
+		}
+		owners[key] = rating.ProviderID
+	}
+
+	for start := 0; start < len(ratings); start += maxBatchRows {
+		chunk := ratings[start:min(start+maxBatchRows, len(ratings))]
+		args := make([]any, 0, 6*len(chunk))
+		for _, rating := range chunk {
+			args = append(args, rating.RecordID, rating.RecordType, rating.UserID, rating.Value, rating.ProviderID, rating.Weight)
+		}
+		q := "INSERT INTO ratings (record_id, record_type, user_id, value, provider_id, weight) VALUES " +
+			strings.Repeat("(?, ?, ?, ?, ?, ?), ", len(chunk)-1) + "(?, ?, ?, ?, ?, ?)" +
+			" ON DUPLICATE KEY UPDATE " + upsertColumns
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := recomputeAggregates(ctx, tx, ratings); err != nil {
+		return err
+	}
+	if err := markProcessed(ctx, tx, processedKeys...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes a user's rating for a given record on behalf of a provider and returns it.
+// It returns repository.ErrNotOwned if the provider may not remove the rating.
+// The running aggregate of the record, the outbox if event is not nil, and the processed events if processedKey
+// is not empty, are updated in the same transaction.
+func (r *Repository) Delete(ctx context.Context, recordID model.RecordID, recordType model.RecordType, userID model.UserID, providerID string, event *model.RatingEvent, processedKey string) (*model.Rating, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	prev, err := lockRating(ctx, tx, recordID, recordType, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !repository.CanChange(providerID, prev.ProviderID) {
+		return nil, repository.ErrNotOwned
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM ratings WHERE record_id = ? AND record_type = ? AND user_id = ?",
+		recordID, recordType, userID); err != nil {
+		return nil, err
+	}
+
+	if err := updateAggregate(ctx, tx, recordID, recordType, prev.Value, prev.Weight, -1); err != nil {
+		return nil, err
+	}
+	if err := addToOutbox(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := markProcessed(ctx, tx, processedKey); err != nil {
+		return nil, err
+	}
+	return prev, tx.Commit()
+}
+
+// DeleteByProvider removes all ratings ingested from a given provider and returns them.
+// The running aggregates of the touched records and the outbox, with the event returned by newEvent
+// for each removed rating, are updated in the same transaction. newEvent is called before the
+// transaction is committed, so before the removals are visible to readers.
+func (r *Repository) DeleteByProvider(ctx context.Context, providerID string, newEvent func(model.Rating) *model.RatingEvent) ([]model.Rating, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT record_id, record_type, user_id, value, weight FROM ratings WHERE provider_id = ? FOR UPDATE", providerID)
+	if err != nil {
+		return nil, err
+	}
 	var res []model.Rating
 	for rows.Next() {
-		var userID string
+		var recordID, recordType, userID string
 		var value int32
-		if err := rows.Scan(&userID, &value); err != nil {
+		var weight float64
+		if err := rows.Scan(&recordID, &recordType, &userID, &value, &weight); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res = append(res, model.Rating{
+			RecordID:   model.RecordID(recordID),
+			RecordType: model.RecordType(recordType),
+			UserID:     model.UserID(userID),
+			Value:      model.RatingValue(value),
+			ProviderID: providerID,
+			Weight:     weight,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM ratings WHERE provider_id = ?", providerID); err != nil {
+		return nil, err
+	}
+	if err := recomputeAggregates(ctx, tx, res); err != nil {
+		return nil, err
+	}
+	for _, rating := range res {
+		if err := addToOutbox(ctx, tx, newEvent(rating)); err != nil {
+			return nil, err
+		}
+	}
+	return res, tx.Commit()
+}
+
+// ListOutbox retrieves the oldest rating events of the outbox.
+func (r *Repository) ListOutbox(ctx context.Context, limit int) ([]repository.OutboxEntry, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, event_id, record_id, record_type, user_id, value, event_type FROM rating_outbox ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []repository.OutboxEntry
+	for rows.Next() {
+		var id int64
+		var eventID, recordID, recordType, userID, eventType string
+		var value int32
+		if err := rows.Scan(&id, &eventID, &recordID, &recordType, &userID, &value, &eventType); err != nil {
+			return nil, err
+		}
+		res = append(res, repository.OutboxEntry{
+			ID: id,
+			Event: model.RatingEvent{
+				Rating: model.Rating{
+					RecordID:   model.RecordID(recordID),
+					RecordType: model.RecordType(recordType),
+					UserID:     model.UserID(userID),
+					Value:      model.RatingValue(value),
+				},
+				EventID:   eventID,
+				EventType: model.RatingEventType(eventType),
+			},
+		})
+	}
+	return res, rows.Err()
+}
+
+// DeleteOutbox removes published rating events from the outbox.
+func (r *Repository) DeleteOutbox(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err := r.db.ExecContext(ctx, "DELETE FROM rating_outbox WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", args...)
+	return err
+}
+
+// RebuildAggregates recomputes the running aggregates of all records from the individual ratings.
+// It is meant for repairing aggregates that drifted from the ratings table.
+func (r *Repository) RebuildAggregates(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM rating_histograms",
+		"DELETE FROM rating_aggregates",
+		"INSERT INTO rating_aggregates (record_id, record_type, rating_count, rating_sum, weight_total, weighted_sum) SELECT record_id, record_type, COUNT(*), SUM(value), SUM(weight), SUM(weight * value) FROM ratings GROUP BY record_id, record_type",
+		"INSERT INTO rating_histograms (record_id, record_type, value, rating_count) SELECT record_id, record_type, value, COUNT(*) FROM ratings GROUP BY record_id, record_type, value",
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ProcessedEvents returns which of the ingested events with the given keys have been processed.
+func (r *Repository) ProcessedEvents(ctx context.Context, keys []string) (map[string]bool, error) {
+	res := map[string]bool{}
+	if len(keys) == 0 {
+		return res, nil
+	}
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	rows, err := r.db.QueryContext(ctx, "SELECT event_key FROM processed_events WHERE event_key IN (?"+strings.Repeat(", ?", len(keys)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		res[key] = true
+	}
+	return res, rows.Err()
+}
+
+// MarkEventsProcessed records that the ingested events with the given keys have been processed.
+func (r *Repository) MarkEventsProcessed(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	_, err := r.db.ExecContext(ctx, "INSERT IGNORE INTO processed_events (event_key) VALUES (?)"+strings.Repeat(", (?)", len(keys)-1), args...)
+	return err
+}
+
+// PruneProcessedEvents forgets the ingested events processed before a given time and returns how many were forgotten.
+func (r *Repository) PruneProcessedEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM processed_events WHERE processed_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// scanRatings reads the ratings of a record from rows of user_id, value, provider_id, weight, created_at and updated_at.
+func scanRatings(rows *sql.Rows, recordID model.RecordID, recordType model.RecordType) ([]model.Rating, error) {
+	var res []model.Rating
+	for rows.Next() {
+		var userID, providerID string
+		var value int32
+		var weight float64
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&userID, &value, &providerID, &weight, &createdAt, &updatedAt); err != nil {
 			return nil, err
 		}
 
 		// Append the rating to the result slice.
 		res = append(res, model.Rating{
-			UserID: model.UserID(userID),
-			Value:  model.RatingValue(value),
+			RecordID:   recordID,
+			RecordType: recordType,
+			UserID:     model.UserID(userID),
+			Value:      model.RatingValue(value),
+			ProviderID: providerID,
+			Weight:     weight,
+			CreatedAt:  createdAt,
+			UpdatedAt:  updatedAt,
 		})
 	}
+	return res, rows.Err()
+}
+
+// lockRating reads a user's rating for a given record and locks its row until the transaction ends.
+func lockRating(ctx context.Context, tx *sql.Tx, recordID model.RecordID, recordType model.RecordType, userID model.UserID) (*model.Rating, error) {
+	var value int32
+	var providerID string
+	var weight float64
+	row := tx.QueryRowContext(ctx, "SELECT value, provider_id, weight FROM ratings WHERE record_id = ? AND record_type = ? AND user_id = ? FOR UPDATE", recordID, recordType, userID)
+	if err := row.Scan(&value, &providerID, &weight); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return &model.Rating{
+		RecordID:   recordID,
+		RecordType: recordType,
+		UserID:     userID,
+		Value:      model.RatingValue(value),
+		ProviderID: providerID,
+		Weight:     weight,
+	}, nil
+}
 
+// ratingKey identifies the rating of a user for a record.
+type ratingKey struct {
+	recordID   model.RecordID
+	recordType model.RecordType
+	userID     model.UserID
+}
+
+// lockOwners locks the stored ratings replaced by the given ones and returns their providers.
+func lockOwners(ctx context.Context, tx *sql.Tx, ratings []model.Rating) (map[ratingKey]string, error) {
+	res := map[ratingKey]string{}
+	for start := 0; start < len(ratings); start += maxBatchRows {
+		chunk := ratings[start:min(start+maxBatchRows, len(ratings))]
+		args := make([]any, 0, 3*len(chunk))
+		for _, rating := range chunk {
+			args = append(args, rating.RecordID, rating.RecordType, rating.UserID)
+		}
+		rows, err := tx.QueryContext(ctx, "SELECT record_id, record_type, user_id, provider_id FROM ratings WHERE (record_id, record_type, user_id) IN ("+
+			strings.Repeat("(?, ?, ?), ", len(chunk)-1)+"(?, ?, ?)) FOR UPDATE", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var recordID, recordType, userID, providerID string
+			if err := rows.Scan(&recordID, &recordType, &userID, &providerID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res[ratingKey{model.RecordID(recordID), model.RecordType(recordType), model.UserID(userID)}] = providerID
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
 	return res, nil
 }
 
-// Put adds a rating for a given record.
-func (r *Repository) Put(ctx context.Context, recordID model.RecordID, recordType model.RecordType, rating *model.Rating) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO ratings (record_id, record_type, user_id, value) VALUES (?, ?, ?, ?)",
-		recordID, recordType, rating.UserID, rating.Value)
+// updateAggregate adds n ratings of the given value and weight to the running aggregate of a record.
+// A negative n removes ratings.
+func updateAggregate(ctx context.Context, tx *sql.Tx, recordID model.RecordID, recordType model.RecordType, value model.RatingValue, weight float64, n int64) error {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO rating_aggregates (record_id, record_type, rating_count, rating_sum, weight_total, weighted_sum) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE rating_count = rating_count + VALUES(rating_count), rating_sum = rating_sum + VALUES(rating_sum), weight_total = weight_total + VALUES(weight_total), weighted_sum = weighted_sum + VALUES(weighted_sum)",
+		recordID, recordType, n, n*int64(value), float64(n)*weight, float64(n)*weight*float64(value)); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO rating_histograms (record_id, record_type, value, rating_count) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE rating_count = rating_count + VALUES(rating_count)",
+		recordID, recordType, value, n)
+	return err
+}
+
+// addToOutbox writes a rating event to the outbox unless it is nil.
+func addToOutbox(ctx context.Context, tx *sql.Tx, event *model.RatingEvent) error {
+	if event == nil {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO rating_outbox (event_id, record_id, record_type, user_id, value, event_type) VALUES (?, ?, ?, ?, ?, ?)",
+		event.EventID, event.RecordID, event.RecordType, event.UserID, event.Value, event.EventType)
+	return err
+}
+
+// markProcessed records that the ingested events with the given non-empty keys have been processed.
+func markProcessed(ctx context.Context, tx *sql.Tx, keys ...string) error {
+	keys = slices.DeleteFunc(slices.Clone(keys), func(key string) bool { return key == "" })
+	for start := 0; start < len(keys); start += maxBatchRows {
+		chunk := keys[start:min(start+maxBatchRows, len(keys))]
+		args := make([]any, len(chunk))
+		for i, key := range chunk {
+			args[i] = key
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO processed_events (event_key) VALUES (?)"+strings.Repeat(", (?)", len(chunk)-1), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recomputeAggregates recomputes the running aggregates of the records of the given ratings once per record.
+func recomputeAggregates(ctx context.Context, tx *sql.Tx, ratings []model.Rating) error {
+	type record struct {
+		id         model.RecordID
+		recordType model.RecordType
+	}
+	touched := map[record]struct{}{}
+	for _, rating := range ratings {
+		rec := record{rating.RecordID, rating.RecordType}
+		if _, ok := touched[rec]; ok {
+			continue
+		}
+		touched[rec] = struct{}{}
+		if err := recomputeAggregate(ctx, tx, rec.id, rec.recordType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recomputeAggregate recomputes the running aggregate of a record from its ratings.
+func recomputeAggregate(ctx context.Context, tx *sql.Tx, recordID model.RecordID, recordType model.RecordType) error {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO rating_aggregates (record_id, record_type, rating_count, rating_sum, weight_total, weighted_sum) SELECT ?, ?, COUNT(*), COALESCE(SUM(value), 0), COALESCE(SUM(weight), 0), COALESCE(SUM(weight * value), 0) FROM ratings WHERE record_id = ? AND record_type = ? ON DUPLICATE KEY UPDATE rating_count = VALUES(rating_count), rating_sum = VALUES(rating_sum), weight_total = VALUES(weight_total), weighted_sum = VALUES(weighted_sum)",
+		recordID, recordType, recordID, recordType); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM rating_histograms WHERE record_id = ? AND record_type = ?", recordID, recordType); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO rating_histograms (record_id, record_type, value, rating_count) SELECT record_id, record_type, value, COUNT(*) FROM ratings WHERE record_id = ? AND record_type = ? GROUP BY record_id, record_type, value",
+		recordID, recordType)
 	return err
 }
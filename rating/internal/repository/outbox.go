@@ -0,0 +1,10 @@
+package repository
+
+import "github.com/akkahshh24/movieapp/rating/pkg/model"
+
+// OutboxEntry defines a rating event that was written along with a rating and waits to be published.
+type OutboxEntry struct {
+	// ID orders the entries by the time they were written.
+	ID    int64
+	Event model.RatingEvent
+}
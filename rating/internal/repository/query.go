@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/akkahshh24/movieapp/rating/pkg/model"
+)
+
+// HistoryQuery defines a page of the ratings of a record, ordered by update time and user id.
+type HistoryQuery struct {
+	// Start and End limit the update time of the ratings to [Start, End). Zero values leave the range open.
+	Start time.Time
+	End   time.Time
+	// After, if set, makes the page start right after the given position.
+	After *HistoryCursor
+	// Limit is the maximum number of ratings to return.
+	Limit int
+}
+
+// HistoryCursor defines a position in the rating history of a record.
+type HistoryCursor struct {
+	UpdatedAt time.Time    `json:"updatedAt"`
+	UserID    model.UserID `json:"userId"`
+}
+
+// RatingSort defines the order of the ratings of a user.
+type RatingSort string
+
+// Supported rating sort orders. Ties are broken by record type and record id.
+const (
+	RatingSortTime  = RatingSort("time")
+	RatingSortValue = RatingSort("value")
+)
+
+// UserRatingsQuery defines a page of the ratings of a user.
+type UserRatingsQuery struct {
+	// RecordType, if set, limits the ratings to records of the given type.
+	RecordType model.RecordType
+	// SortBy defines the order of the ratings.
+	SortBy RatingSort
+	// Descending reverses the order of the ratings.
+	Descending bool
+	// After, if set, makes the page start right after the given position.
+	After *UserRatingsCursor
+	// Limit is the maximum number of ratings to return.
+	Limit int
+}
+
+// UserRatingsCursor defines a position in the ratings of a user.
+type UserRatingsCursor struct {
+	Value      model.RatingValue `json:"value"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	RecordType model.RecordType  `json:"recordType"`
+	RecordID   model.RecordID    `json:"recordId"`
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/akkahshh24/movieapp/gen"
+	"google.golang.org/protobuf/proto"
+)
+
+// Names of the message headers describing the encoding of a rating event.
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+)
+
+// Content types of encoded rating events.
+const (
+	ContentTypeJSON  = "application/json"
+	ContentTypeProto = "application/x-protobuf"
+)
+
+// RatingEventSchemaVersion is the version of the rating event schema written by this package.
+// Messages without a schema version are treated as version 1.
+const RatingEventSchemaVersion = "1"
+
+// ratingEventJSON is the JSON encoding of a rating event. It leaves out the weight and the timestamps
+// of the rating, which are set when the rating is stored.
+type ratingEventJSON struct {
+	EventID    string          `json:"eventId,omitempty"`
+	RecordID   RecordID        `json:"recordId"`
+	RecordType RecordType      `json:"recordType"`
+	UserID     UserID          `json:"userId"`
+	Value      RatingValue     `json:"value"`
+	ProviderID string          `json:"providerId,omitempty"`
+	EventType  RatingEventType `json:"eventType"`
+}
+
+// MarshalJSON encodes a rating event without the fields set when its rating is stored.
+func (e RatingEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ratingEventJSON{
+		EventID:    e.EventID,
+		RecordID:   e.RecordID,
+		RecordType: e.RecordType,
+		UserID:     e.UserID,
+		Value:      e.Value,
+		ProviderID: e.ProviderID,
+		EventType:  e.EventType,
+	})
+}
+
+// MarshalRatingEvent encodes a rating event with the given content type.
+func MarshalRatingEvent(e *RatingEvent, contentType string) ([]byte, error) {
+	switch contentType {
+	case ContentTypeJSON:
+		return json.Marshal(e)
+	case ContentTypeProto:
+		return proto.Marshal(e.ToProto())
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// UnmarshalRatingEvent decodes a rating event encoded with the given content type and schema version.
+// Messages without a content type are decoded as JSON, which was the only format before versioning.
+func UnmarshalRatingEvent(data []byte, contentType string, schemaVersion string) (*RatingEvent, error) {
+	if schemaVersion != "" && schemaVersion != RatingEventSchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %q", schemaVersion)
+	}
+
+	switch contentType {
+	case "", ContentTypeJSON:
+		var e RatingEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		return &e, nil
+	case ContentTypeProto:
+		var e gen.RatingEvent
+		if err := proto.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		return ProtoToRatingEvent(&e), nil
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingEventRoundTrip(t *testing.T) {
+	events := []RatingEvent{
+		{
+			Rating:    Rating{RecordID: "1", RecordType: RecordTypeMovie, UserID: "alice", Value: 5, ProviderID: "partner"},
+			EventID:   "1",
+			EventType: RatingEventTypePut,
+		},
+		{
+			Rating:    Rating{RecordID: "1", RecordType: RecordTypeMovie, UserID: "alice"},
+			EventID:   "2",
+			EventType: RatingEventTypeDelete,
+		},
+	}
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeProto} {
+		for _, e := range events {
+			t.Run(contentType+"/"+string(e.EventType), func(t *testing.T) {
+				data, err := MarshalRatingEvent(&e, contentType)
+				require.NoError(t, err)
+				got, err := UnmarshalRatingEvent(data, contentType, RatingEventSchemaVersion)
+				require.NoError(t, err)
+				assert.Equal(t, &e, got)
+			})
+		}
+	}
+}
+
+func TestMarshalRatingEventJSON(t *testing.T) {
+	e := RatingEvent{
+		Rating: Rating{
+			RecordID: "1", RecordType: RecordTypeMovie, UserID: "alice", Value: 5, ProviderID: "partner",
+			Weight: 3, CreatedAt: time.Unix(1, 0), UpdatedAt: time.Unix(2, 0),
+		},
+		EventID:   "1",
+		EventType: RatingEventTypePut,
+	}
+	data, err := MarshalRatingEvent(&e, ContentTypeJSON)
+	require.NoError(t, err)
+	// The weight and the timestamps are set when the rating is stored, so they are not part of the event.
+	assert.JSONEq(t, `{"eventId": "1", "recordId": "1", "recordType": "movie", "userId": "alice", "value": 5, "providerId": "partner", "eventType": "put"}`, string(data))
+}
+
+func TestUnmarshalRatingEvent(t *testing.T) {
+	e := RatingEvent{
+		Rating:    Rating{RecordID: "1", RecordType: RecordTypeMovie, UserID: "alice", Value: 4},
+		EventID:   "1",
+		EventType: RatingEventTypePut,
+	}
+	data, err := MarshalRatingEvent(&e, ContentTypeJSON)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		contentType   string
+		schemaVersion string
+		wantErr       string
+	}{
+		// Messages written before versioning have neither header.
+		{name: "unversioned"},
+		{name: "unknown content type", contentType: "application/xml", wantErr: `unsupported content type "application/xml"`},
+		{name: "unknown version", contentType: ContentTypeJSON, schemaVersion: "2", wantErr: `unsupported schema version "2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalRatingEvent(data, tt.contentType, tt.schemaVersion)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &e, got)
+		})
+	}
+
+	_, err = MarshalRatingEvent(&e, "application/xml")
+	assert.EqualError(t, err, `unsupported content type "application/xml"`)
+}
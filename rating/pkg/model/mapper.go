@@ -0,0 +1,102 @@
+package model
+
+import (
+	"github.com/akkahshh24/movieapp/gen"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ToProto converts an AggregatedRating struct into a generated proto counterpart.
+func (a *AggregatedRating) ToProto() *gen.GetAggregatedRatingResponse {
+	histogram := make(map[int32]int64, len(a.Histogram))
+	for v, n := range a.Histogram {
+		histogram[int32(v)] = n
+	}
+	return &gen.GetAggregatedRatingResponse{
+		RatingValue:     a.Value,
+		RatingCount:     a.Count,
+		RatingSum:       a.Sum,
+		RatingHistogram: histogram,
+	}
+}
+
+// ProtoToAggregatedRating converts a generated proto counterpart into an AggregatedRating struct.
+func ProtoToAggregatedRating(r *gen.GetAggregatedRatingResponse) *AggregatedRating {
+	histogram := make(map[RatingValue]int64, len(r.RatingHistogram))
+	for v, n := range r.RatingHistogram {
+		histogram[RatingValue(v)] = n
+	}
+	return &AggregatedRating{
+		Value:     r.RatingValue,
+		Count:     r.RatingCount,
+		Sum:       r.RatingSum,
+		Histogram: histogram,
+	}
+}
+
+// ToProto converts a Rating struct into a generated proto counterpart.
+func (r *Rating) ToProto() *gen.Rating {
+	return &gen.Rating{
+		UserId:      string(r.UserID),
+		RecordId:    string(r.RecordID),
+		RecordType:  string(r.RecordType),
+		RatingValue: int32(r.Value),
+		CreatedAt:   timestamppb.New(r.CreatedAt),
+		UpdatedAt:   timestamppb.New(r.UpdatedAt),
+		ProviderId:  r.ProviderID,
+	}
+}
+
+// ProtoToRating converts a generated proto counterpart into a Rating struct.
+func ProtoToRating(r *gen.Rating) *Rating {
+	return &Rating{
+		UserID:     UserID(r.UserId),
+		RecordID:   RecordID(r.RecordId),
+		RecordType: RecordType(r.RecordType),
+		Value:      RatingValue(r.RatingValue),
+		ProviderID: r.ProviderId,
+		CreatedAt:  r.CreatedAt.AsTime(),
+		UpdatedAt:  r.UpdatedAt.AsTime(),
+	}
+}
+
+// ToProto converts a RatingEvent struct into a generated proto counterpart.
+func (e *RatingEvent) ToProto() *gen.RatingEvent {
+	eventType := gen.RatingEventType_RATING_EVENT_TYPE_UNSPECIFIED
+	switch e.EventType {
+	case RatingEventTypePut:
+		eventType = gen.RatingEventType_RATING_EVENT_TYPE_PUT
+	case RatingEventTypeDelete:
+		eventType = gen.RatingEventType_RATING_EVENT_TYPE_DELETE
+	}
+	return &gen.RatingEvent{
+		EventId:     e.EventID,
+		UserId:      string(e.UserID),
+		RecordId:    string(e.RecordID),
+		RecordType:  string(e.RecordType),
+		RatingValue: int32(e.Value),
+		ProviderId:  e.ProviderID,
+		EventType:   eventType,
+	}
+}
+
+// ProtoToRatingEvent converts a generated proto counterpart into a RatingEvent struct.
+func ProtoToRatingEvent(e *gen.RatingEvent) *RatingEvent {
+	var eventType RatingEventType
+	switch e.EventType {
+	case gen.RatingEventType_RATING_EVENT_TYPE_PUT:
+		eventType = RatingEventTypePut
+	case gen.RatingEventType_RATING_EVENT_TYPE_DELETE:
+		eventType = RatingEventTypeDelete
+	}
+	return &RatingEvent{
+		Rating: Rating{
+			UserID:     UserID(e.UserId),
+			RecordID:   RecordID(e.RecordId),
+			RecordType: RecordType(e.RecordType),
+			Value:      RatingValue(e.RatingValue),
+			ProviderID: e.ProviderId,
+		},
+		EventID:   e.EventId,
+		EventType: eventType,
+	}
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // RecordID defines a record id. Together with RecordType identifies unique records across all types.
 type RecordID string
 
@@ -23,13 +25,78 @@ type Rating struct {
 	RecordType RecordType  `json:"recordType"`
 	UserID     UserID      `json:"userId"`
 	Value      RatingValue `json:"value"`
+	// ProviderID is the provider the rating was ingested from. It is empty for ratings made through the API.
+	ProviderID string `json:"providerId,omitempty"`
+	// Weight is the trust in the rating, relative to a rating made through the API, which has a weight of 1.
+	Weight    float64   `json:"weight,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// AggregatedRating defines the aggregated rating of a record along with the numbers it was computed from.
+type AggregatedRating struct {
+	Value float64 `json:"value"`
+	Count int64   `json:"count"`
+	Sum   int64   `json:"sum"`
+	// Histogram counts the ratings of each value.
+	// For example, {5: 10, 4: 2} for ten 5-star and two 4-star ratings.
+	Histogram map[RatingValue]int64 `json:"histogram"`
+
+	// Weight and WeightedSum are the sums of the weights and of the weighted values of the ratings.
+	Weight      float64 `json:"weight"`
+	WeightedSum float64 `json:"weightedSum"`
+}
+
+// Add accounts for a new rating value with the given weight in the aggregated rating.
+func (a *AggregatedRating) Add(v RatingValue, weight float64) {
+	a.update(v, weight, 1)
+}
+
+// Remove discounts a previously added rating value with the given weight from the aggregated rating.
+func (a *AggregatedRating) Remove(v RatingValue, weight float64) {
+	a.update(v, weight, -1)
+}
+
+func (a *AggregatedRating) update(v RatingValue, weight float64, n int64) {
+	if a.Histogram == nil {
+		a.Histogram = map[RatingValue]int64{}
+	}
+	a.Count += n
+	a.Sum += n * int64(v)
+	a.Weight += float64(n) * weight
+	a.WeightedSum += float64(n) * weight * float64(v)
+	if a.Histogram[v] += n; a.Histogram[v] <= 0 {
+		delete(a.Histogram, v)
+	}
+
+	a.Value = 0
+	if a.Count <= 0 {
+		// Drop the rounding errors accumulated by the weights.
+		a.Weight, a.WeightedSum = 0, 0
+	} else if a.Weight > 0 {
+		a.Value = a.WeightedSum / a.Weight
+	} else {
+		// None of the ratings is trusted more than another.
+		a.Value = float64(a.Sum) / float64(a.Count)
+	}
 }
 
 // RatingEvent defines an event containing rating information.
 type RatingEvent struct {
 	Rating
-	ProviderID string          `json:"providerId"`
-	EventType  RatingEventType `json:"eventType"`
+	// EventID optionally identifies the event. It is used to recognize redelivered events.
+	EventID   string          `json:"eventId,omitempty"`
+	EventType RatingEventType `json:"eventType"`
+}
+
+// Key returns the key that recognizes a redelivered event with an id, or an empty string for events
+// without one. Event ids are chosen by providers, so the key is scoped to the provider to keep two
+// providers reusing the same id from colliding.
+func (e *RatingEvent) Key() string {
+	if e.EventID == "" {
+		return ""
+	}
+	return e.ProviderID + "/" + e.EventID
 }
 
 // RatingEventType defines the type of a rating event.
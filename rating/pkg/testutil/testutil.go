@@ -5,13 +5,15 @@ import (
 	cachememory "github.com/akkahshh24/movieapp/rating/internal/cache/memory"
 	"github.com/akkahshh24/movieapp/rating/internal/controller/rating"
 	grpchandler "github.com/akkahshh24/movieapp/rating/internal/handler/grpc"
+	ingestermemory "github.com/akkahshh24/movieapp/rating/internal/ingester/memory"
 	repomemory "github.com/akkahshh24/movieapp/rating/internal/repository/memory"
 )
 
 // NewTestRatingGRPCServer creates a new rating gRPC server to be used in tests.
 func NewTestRatingGRPCServer() gen.RatingServiceServer {
 	repo := repomemory.New()
-	cache := cachememory.New()
-	ctrl := rating.New(repo, cache, nil)
+	cache := cachememory.New(0, 0)
+	ingester := ingestermemory.New(0)
+	ctrl := rating.New(repo, cache, ingester, rating.DefaultAggregation(), rating.DefaultRecordTypeRegistry(), rating.DefaultIngestionConfig(), 0)
 	return grpchandler.New(ctrl)
 }
@@ -0,0 +1,6 @@
+-- Adds the timestamps of the ratings and the index of the rating history to a database created
+-- before them. Existing ratings are stamped with the time of the migration.
+ALTER TABLE ratings
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX ratings_updated_at (record_id, record_type, updated_at, user_id);
@@ -0,0 +1,2 @@
+-- Adds the index of the ratings of a user to a database created before it.
+CREATE INDEX ratings_user_id ON ratings (user_id, record_type, updated_at);
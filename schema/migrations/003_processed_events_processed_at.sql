@@ -0,0 +1,2 @@
+-- Adds the index used to prune the processed events to a database created before it.
+CREATE INDEX processed_events_processed_at ON processed_events (processed_at);
@@ -0,0 +1,13 @@
+-- Adds the providers and weights of the ratings to a database created before them. Existing ratings
+-- were made through the API, so they have no provider and a weight of 1, and the weighted sums of the
+-- aggregates are backfilled to match.
+ALTER TABLE ratings
+    ADD COLUMN provider_id VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN weight DOUBLE NOT NULL DEFAULT 1,
+    ADD INDEX ratings_provider_id (provider_id);
+
+ALTER TABLE rating_aggregates
+    ADD COLUMN weight_total DOUBLE NOT NULL DEFAULT 0,
+    ADD COLUMN weighted_sum DOUBLE NOT NULL DEFAULT 0;
+
+UPDATE rating_aggregates SET weight_total = rating_count, weighted_sum = rating_sum;
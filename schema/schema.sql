@@ -1,3 +1,6 @@
+-- Creates the tables of a new database. Databases created by an earlier version are upgraded by
+-- applying the scripts of the migrations directory not applied yet, in order, with make migrate.
+
 CREATE TABLE IF NOT EXISTS movies (
     id VARCHAR(255) PRIMARY KEY, 
     title VARCHAR(255), 
@@ -10,5 +13,47 @@ CREATE TABLE IF NOT EXISTS ratings (
     record_type VARCHAR(255), 
     user_id VARCHAR(255), 
     value INT, 
-    PRIMARY KEY (record_id, record_type, user_id)
-);
\ No newline at end of file
+    provider_id VARCHAR(255) NOT NULL DEFAULT '',
+    weight DOUBLE NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (record_id, record_type, user_id),
+    INDEX ratings_updated_at (record_id, record_type, updated_at, user_id),
+    INDEX ratings_user_id (user_id, record_type, updated_at),
+    INDEX ratings_provider_id (provider_id)
+);
+
+CREATE TABLE IF NOT EXISTS rating_aggregates (
+    record_id VARCHAR(255),
+    record_type VARCHAR(255),
+    rating_count BIGINT NOT NULL DEFAULT 0,
+    rating_sum BIGINT NOT NULL DEFAULT 0,
+    weight_total DOUBLE NOT NULL DEFAULT 0,
+    weighted_sum DOUBLE NOT NULL DEFAULT 0,
+    PRIMARY KEY (record_id, record_type)
+);
+
+CREATE TABLE IF NOT EXISTS rating_histograms (
+    record_id VARCHAR(255),
+    record_type VARCHAR(255),
+    value INT,
+    rating_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (record_id, record_type, value)
+);
+
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_key VARCHAR(255) PRIMARY KEY,
+    processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX processed_events_processed_at (processed_at)
+);
+
+CREATE TABLE IF NOT EXISTS rating_outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(255) NOT NULL,
+    record_id VARCHAR(255),
+    record_type VARCHAR(255),
+    user_id VARCHAR(255),
+    value INT,
+    event_type VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
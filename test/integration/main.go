@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/akkahshh24/movieapp/gen"
 	"github.com/akkahshh24/movieapp/pkg/discovery/memory"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -29,6 +33,7 @@ func main() {
 
 	ctx := context.Background()
 	registry := memory.NewRegistry()
+	go registry.StartReaper(ctx, time.Second)
 
 	// Instantiate our services
 	log.Println("Setting up service handlers and clients")
@@ -118,15 +123,40 @@ func main() {
 	const userID = "user0"
 	const recordTypeMovie = "movie"
 	firstRating := int32(5)
-	if _, err = ratingClient.PutRating(ctx, &gen.PutRatingRequest{
+	putRatingResp, err := ratingClient.PutRating(ctx, &gen.PutRatingRequest{
 		UserId:      userID,
 		RecordId:    m.Id,
 		RecordType:  recordTypeMovie,
 		RatingValue: firstRating,
-	}); err != nil {
+	})
+	if err != nil {
 		log.Fatalf("put rating: %v", err)
 	}
 
+	if !putRatingResp.Created {
+		log.Fatalf("put rating: expected the first rating to be created")
+	}
+
+	// Write a rating outside of the movie rating scale and check that it is rejected
+	// with a field violation for the rating value.
+	log.Println("Rating service :: PutRating :: Saving invalid rating")
+
+	_, err = ratingClient.PutRating(ctx, &gen.PutRatingRequest{
+		UserId:      userID,
+		RecordId:    m.Id,
+		RecordType:  recordTypeMovie,
+		RatingValue: 1000,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		log.Fatalf("put invalid rating: got %v want %v", err, codes.InvalidArgument)
+	}
+
+	if details := status.Convert(err).Details(); len(details) != 1 {
+		log.Fatalf("put invalid rating: got details %v want one bad request", details)
+	} else if badRequest, ok := details[0].(*errdetails.BadRequest); !ok || badRequest.FieldViolations[0].Field != "rating_value" {
+		log.Fatalf("put invalid rating: got details %v want a rating_value violation", details)
+	}
+
 	// Retrieve the initial aggregated rating for our movie using the rating service API
 	// (the GetAggregatedRating endpoint) and check that the value matches the one that we just
 	// submitted in the previous step.
@@ -144,13 +174,14 @@ func main() {
 		log.Fatalf("rating mismatch: got %v want %v", got, want)
 	}
 
-	// Write the second rating for our example movie using the rating service API
+	// Write the second rating for our example movie from another user using the rating service API
 	// and check that the operation does not return any errors.
 	log.Println("Rating service :: PutRating :: Saving second rating")
 
+	const secondUserID = "user1"
 	secondRating := int32(1)
 	if _, err = ratingClient.PutRating(ctx, &gen.PutRatingRequest{
-		UserId:      userID,
+		UserId:      secondUserID,
 		RecordId:    m.Id,
 		RecordType:  recordTypeMovie,
 		RatingValue: secondRating,
@@ -175,6 +206,91 @@ func main() {
 		log.Fatalf("rating mismatch: got %v want %v", got, want)
 	}
 
+	// Rate the movie again as the first user and check that the rating replaces
+	// the previous one instead of being counted twice.
+	log.Println("Rating service :: PutRating :: Updating first rating")
+
+	updatedFirstRating := int32(3)
+	putRatingResp, err = ratingClient.PutRating(ctx, &gen.PutRatingRequest{
+		UserId:      userID,
+		RecordId:    m.Id,
+		RecordType:  recordTypeMovie,
+		RatingValue: updatedFirstRating,
+	})
+	if err != nil {
+		log.Fatalf("put rating: %v", err)
+	}
+
+	if putRatingResp.Created {
+		log.Fatalf("put rating: expected the first rating to be updated")
+	}
+
+	getAggregatedRatingResp, err = ratingClient.GetAggregatedRating(ctx, &gen.GetAggregatedRatingRequest{
+		RecordId:   m.Id,
+		RecordType: recordTypeMovie,
+	})
+	if err != nil {
+		log.Fatalf("get aggreggated rating: %v", err)
+	}
+
+	wantRating = float64(updatedFirstRating+secondRating) / 2
+	if got, want := getAggregatedRatingResp.RatingValue, wantRating; got != want {
+		log.Fatalf("rating mismatch: got %v want %v", got, want)
+	}
+
+	if got, want := getAggregatedRatingResp.RatingCount, int64(2); got != want {
+		log.Fatalf("rating count mismatch: got %v want %v", got, want)
+	}
+
+	wantHistogram := map[int32]int64{updatedFirstRating: 1, secondRating: 1}
+	if diff := cmp.Diff(getAggregatedRatingResp.RatingHistogram, wantHistogram); diff != "" {
+		log.Fatalf("rating histogram mismatch: %v", diff)
+	}
+
+	// Page through the rating history of our movie one rating at a time
+	// and check that both ratings are returned.
+	log.Println("Rating service :: ListRatingHistory :: Listing rating history")
+
+	var historyUserIDs []string
+	var pageToken string
+	for {
+		historyResp, err := ratingClient.ListRatingHistory(ctx, &gen.ListRatingHistoryRequest{
+			RecordId:   m.Id,
+			RecordType: recordTypeMovie,
+			PageSize:   1,
+			PageToken:  pageToken,
+		})
+		if err != nil {
+			log.Fatalf("list rating history: %v", err)
+		}
+		for _, r := range historyResp.Ratings {
+			historyUserIDs = append(historyUserIDs, r.UserId)
+		}
+		if pageToken = historyResp.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	if diff := cmp.Diff(historyUserIDs, []string{secondUserID, userID}); diff != "" {
+		log.Fatalf("rating history mismatch: %v", diff)
+	}
+
+	// List the ratings of the first user and check that only the updated rating is returned.
+	log.Println("Rating service :: ListUserRatings :: Listing user ratings")
+
+	userRatingsResp, err := ratingClient.ListUserRatings(ctx, &gen.ListUserRatingsRequest{
+		UserId:     userID,
+		RecordType: recordTypeMovie,
+		SortBy:     "value",
+	})
+	if err != nil {
+		log.Fatalf("list user ratings: %v", err)
+	}
+
+	if len(userRatingsResp.Ratings) != 1 || userRatingsResp.Ratings[0].RatingValue != updatedFirstRating {
+		log.Fatalf("user ratings mismatch: got %v", userRatingsResp.Ratings)
+	}
+
 	// Get the movie details for our example movie and check that the result
 	// includes the up-dated rating.
 	log.Println("Movie service :: GetMovieDetails :: Getting updated movie details")
@@ -185,6 +301,9 @@ func main() {
 	}
 
 	wantMovieDetails.Rating = wantRating
+	wantMovieDetails.RatingCount = 2
+	wantMovieDetails.RatingSum = int64(updatedFirstRating + secondRating)
+	wantMovieDetails.RatingHistogram = wantHistogram
 	if diff := cmp.Diff(getMovieDetailsResp.MovieDetails, wantMovieDetails, cmpopts.IgnoreUnexported(gen.MovieDetails{}, gen.Metadata{})); diff != "" {
 		log.Fatalf("get movie details after update mismatch: %v", err)
 	}
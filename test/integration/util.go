@@ -36,7 +36,7 @@ func startMetadataService(ctx context.Context, registry discovery.Registry) *grp
 
 	// Register the metadata service with the discovery registry
 	id := discovery.GenerateInstanceID(metadataServiceName)
-	if err := registry.Register(ctx, id, metadataServiceName, metadataServiceAddr); err != nil {
+	if err := registry.Register(ctx, id, metadataServiceName, metadataServiceAddr, nil); err != nil {
 		panic(err)
 	}
 
@@ -74,7 +74,7 @@ func startRatingService(ctx context.Context, registry discovery.Registry) *grpc.
 
 	// Register the rating service with the discovery registry
 	id := discovery.GenerateInstanceID(ratingServiceName)
-	if err := registry.Register(ctx, id, ratingServiceName, ratingServiceAddr); err != nil {
+	if err := registry.Register(ctx, id, ratingServiceName, ratingServiceAddr, nil); err != nil {
 		panic(err)
 	}
 
@@ -112,7 +112,7 @@ func startMovieService(ctx context.Context, registry discovery.Registry) *grpc.S
 
 	// Register the movie service with the discovery registry
 	id := discovery.GenerateInstanceID(movieServiceName)
-	if err := registry.Register(ctx, id, movieServiceName, movieServiceAddr); err != nil {
+	if err := registry.Register(ctx, id, movieServiceName, movieServiceAddr, nil); err != nil {
 		panic(err)
 	}
 